@@ -0,0 +1,103 @@
+// Package audit records the signatures produced by digestsigner and
+// walletsigner.
+package audit
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Operations recorded by the signers.
+const (
+	OpSignDigest = "SignDigest"
+	OpSignData   = "SignData"
+	OpSignText   = "SignText"
+	OpSignTx     = "SignTx"
+	OpSign       = "Sign" // crypto.Signer of a key version, see digestsigner.KMSSigner.CryptoSigner
+)
+
+// Record describes a single signing request and its outcome.
+type Record struct {
+	Time       time.Time         `json:"time"`
+	Operation  string            `json:"operation"`
+	Address    common.Address    `json:"address"` // zero for P-256 keys
+	KeyVersion string            `json:"key_version,omitempty"`
+	Digest     hexutil.Bytes     `json:"digest"`
+	Signature  hexutil.Bytes     `json:"signature,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Tx         *TxSummary        `json:"tx,omitempty"`
+}
+
+// TxSummary is the decoded content of a signed transaction.
+type TxSummary struct {
+	Hash      common.Hash     `json:"hash"`
+	Type      uint8           `json:"type"`
+	ChainID   *hexutil.Big    `json:"chain_id,omitempty"`
+	Nonce     uint64          `json:"nonce"`
+	To        *common.Address `json:"to,omitempty"`
+	Value     *hexutil.Big    `json:"value"`
+	Gas       uint64          `json:"gas"`
+	GasPrice  *hexutil.Big    `json:"gas_price,omitempty"`
+	GasFeeCap *hexutil.Big    `json:"gas_fee_cap,omitempty"`
+	GasTipCap *hexutil.Big    `json:"gas_tip_cap,omitempty"`
+	Selector  hexutil.Bytes   `json:"selector,omitempty"` // first 4 bytes of the call data
+	DataSize  int             `json:"data_size"`
+}
+
+// SummarizeTx decodes the fields of tx worth auditing.
+func SummarizeTx(tx *types.Transaction, chainID *big.Int) *TxSummary {
+	s := &TxSummary{
+		Hash:     tx.Hash(),
+		Type:     tx.Type(),
+		ChainID:  (*hexutil.Big)(chainID),
+		Nonce:    tx.Nonce(),
+		To:       tx.To(),
+		Value:    (*hexutil.Big)(tx.Value()),
+		Gas:      tx.Gas(),
+		DataSize: len(tx.Data()),
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		s.GasFeeCap = (*hexutil.Big)(tx.GasFeeCap())
+		s.GasTipCap = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		s.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+	if len(tx.Data()) >= 4 {
+		s.Selector = common.CopyBytes(tx.Data()[:4])
+	}
+	return s
+}
+
+// Sink receives a Record for every signing request. The signers fail a
+// request whose record could not be written, so that no signature leaves the
+// service unaudited.
+type Sink interface {
+	Write(ctx context.Context, rec *Record) error
+}
+
+type metadataKey struct{}
+
+// WithMetadata returns a context whose signing requests are recorded with md.
+// Metadata already in ctx is kept unless overridden by md.
+func WithMetadata(ctx context.Context, md map[string]string) context.Context {
+	merged := map[string]string{}
+	for k, v := range MetadataFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFromContext returns the metadata attached to ctx by WithMetadata.
+func MetadataFromContext(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return md
+}
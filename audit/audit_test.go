@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03")
+	tx := types.NewTransaction(7, to, big.NewInt(100), 60000, big.NewInt(1), []byte{0xa9, 0x05, 0x9c, 0xbb, 0x01})
+	ctx := WithMetadata(context.Background(), map[string]string{"request": "r1"})
+	ctx = WithMetadata(ctx, map[string]string{"operator": "alice"})
+	for i := 0; i < 2; i++ {
+		rec := &Record{
+			Time:      time.Now().UTC(),
+			Operation: OpSignTx,
+			Address:   common.HexToAddress("0x01"),
+			Digest:    []byte{byte(i)},
+			Signature: []byte{1, 2, 3},
+			Metadata:  MetadataFromContext(ctx),
+			Tx:        SummarizeTx(tx, big.NewInt(1)),
+		}
+		if err := sink.Write(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("file mode: have %o, want 600", perm)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 2 {
+		t.Fatalf("have %d records, want 2", len(records))
+	}
+	rec := records[1]
+	if rec.Digest[0] != 1 || rec.Metadata["request"] != "r1" || rec.Metadata["operator"] != "alice" {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	if rec.Tx == nil || rec.Tx.Nonce != 7 || *rec.Tx.To != to || rec.Tx.Value.ToInt().Int64() != 100 ||
+		common.Bytes2Hex(rec.Tx.Selector) != "a9059cbb" || rec.Tx.DataSize != 5 || rec.Tx.GasFeeCap != nil {
+		t.Errorf("unexpected tx summary %+v", rec.Tx)
+	}
+}
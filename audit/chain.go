@@ -0,0 +1,225 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Entry types of a chained log.
+const (
+	EntryRecord     = "record"
+	EntryCheckpoint = "checkpoint"
+)
+
+// checkpointPrefix separates checkpoint digests from any other digest signed
+// by the checkpoint key.
+var checkpointPrefix = []byte("gcp-kms-signer-dlt audit checkpoint\n")
+
+// Entry is one line of a chained log. Hash commits to the sequence number,
+// the hash of the previous entry and the exact bytes of Body, which is a
+// Record or a Checkpoint depending on Type.
+type Entry struct {
+	Seq  uint64          `json:"seq"`
+	Prev common.Hash     `json:"prev"`
+	Type string          `json:"type"`
+	Body json.RawMessage `json:"body"`
+	Hash common.Hash     `json:"hash"`
+}
+
+// Checkpoint is a signature over the hash of the entry preceding it, made by
+// a key the verifier trusts.
+type Checkpoint struct {
+	Address   common.Address `json:"address"`
+	Head      common.Hash    `json:"head"`
+	Signature hexutil.Bytes  `json:"signature"`
+}
+
+// CheckpointSigner signs checkpoints, e.g. a *digestsigner.KMSSigner holding
+// a key dedicated to the audit log.
+type CheckpointSigner interface {
+	SignDigest(ctx context.Context, address common.Address, digest []byte) ([]byte, error)
+}
+
+// ChainConfig configures the checkpoints of a ChainSink.
+type ChainConfig struct {
+	Signer   CheckpointSigner // (Optional) signs checkpoints, without it the log is only hash chained
+	Address  common.Address   // address of the checkpoint key in Signer
+	Interval int              // (Optional) records between two checkpoints, defaults to DefaultCheckpointInterval
+}
+
+// DefaultCheckpointInterval is the number of records between two checkpoints
+// if ChainConfig.Interval is not set.
+const DefaultCheckpointInterval = 100
+
+// ChainSink appends records to a file as hash chained entries and
+// periodically signs the head of the chain. The checkpoint signer must not
+// itself write to the sink.
+type ChainSink struct {
+	cfg ChainConfig
+
+	mu      sync.Mutex
+	f       *os.File
+	seq     uint64
+	head    common.Hash
+	pending int // records since the last checkpoint
+}
+
+var _ Sink = (*ChainSink)(nil)
+
+// NewChainSink opens path for appending, continuing the chain already in the
+// file if any. The existing chain must be intact, except for a last entry
+// torn by a crash, which is dropped.
+func NewChainSink(path string, cfg ChainConfig) (*ChainSink, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultCheckpointInterval
+	}
+	s := &ChainSink{cfg: cfg}
+	if err := s.resume(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s.f = f
+	return s, nil
+}
+
+// resume checks the chain in path and continues it after its last entry. A
+// last line without newline is the write of a record interrupted by a crash,
+// which was never reported as written, and is truncated.
+func (s *ChainSink) resume(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(data) == 0 {
+				return nil
+			}
+			log.Warn("Truncating torn entry at the end of the audit log", "path", path, "line", line, "bytes", len(data))
+			return f.Truncate(offset)
+		}
+		if err != nil {
+			return err
+		}
+		if len(data) > maxEntrySize {
+			return fmt.Errorf("audit log %s is corrupted: line %d is too long", path, line)
+		}
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("audit log %s is corrupted: %w", path, &TamperError{Line: line, Seq: s.seq, Reason: err.Error()})
+		}
+		if reason := e.follows(s.seq, s.head); reason != "" {
+			return fmt.Errorf("audit log %s is corrupted: %w", path, &TamperError{Line: line, Seq: s.seq, Reason: reason})
+		}
+		if e.Type == EntryCheckpoint {
+			s.pending = 0
+		} else {
+			s.pending++
+		}
+		s.seq++
+		s.head = e.Hash
+		offset += int64(len(data))
+	}
+}
+
+func (s *ChainSink) Write(ctx context.Context, rec *Record) error {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(EntryRecord, body); err != nil {
+		return err
+	}
+	s.pending++
+	if s.cfg.Signer != nil && s.pending >= s.cfg.Interval {
+		if err := s.checkpoint(ctx); err != nil {
+			// the record is safely written, try again with the next one
+			log.Warn("audit checkpoint failed", "seq", s.seq, "err", err)
+		}
+	}
+	return nil
+}
+
+// Checkpoint signs the current head of the chain, e.g. before shutting down.
+func (s *ChainSink) Checkpoint(ctx context.Context) error {
+	if s.cfg.Signer == nil {
+		return fmt.Errorf("no checkpoint signer configured")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkpoint(ctx)
+}
+
+func (s *ChainSink) checkpoint(ctx context.Context) error {
+	sig, err := s.cfg.Signer.SignDigest(ctx, s.cfg.Address, checkpointDigest(s.head))
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(&Checkpoint{Address: s.cfg.Address, Head: s.head, Signature: sig})
+	if err != nil {
+		return err
+	}
+	if err := s.append(EntryCheckpoint, body); err != nil {
+		return err
+	}
+	s.pending = 0
+	return nil
+}
+
+func (s *ChainSink) append(typ string, body []byte) error {
+	e := Entry{Seq: s.seq, Prev: s.head, Type: typ, Body: body}
+	e.Hash = e.computeHash()
+	line, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	s.seq++
+	s.head = e.Hash
+	return nil
+}
+
+// Close closes the underlying file without writing a checkpoint.
+func (s *ChainSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+func (e *Entry) computeHash() common.Hash {
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], e.Seq)
+	return crypto.Keccak256Hash(seq[:], e.Prev[:], []byte(e.Type), []byte{0}, e.Body)
+}
+
+func checkpointDigest(head common.Hash) []byte {
+	return crypto.Keccak256(checkpointPrefix, head[:])
+}
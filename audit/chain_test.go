@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type keySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *keySigner) SignDigest(ctx context.Context, address common.Address, digest []byte) ([]byte, error) {
+	sig, err := crypto.Sign(digest, s.key)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+func writeChain(t *testing.T, path string, cfg ChainConfig, records int) {
+	t.Helper()
+	sink, err := NewChainSink(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < records; i++ {
+		rec := &Record{Time: time.Now().UTC(), Operation: OpSignDigest, Digest: []byte{byte(i)}}
+		if err := sink.Write(context.Background(), rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChainSink(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	cfg := ChainConfig{Signer: &keySigner{key}, Address: crypto.PubkeyToAddress(key.PublicKey), Interval: 2}
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeChain(t, path, cfg, 3)
+	writeChain(t, path, cfg, 2) // resumes the chain
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Verify(bytes.NewReader(data), []common.Address{cfg.Address})
+	if !errors.Is(err, ErrUnsignedHead) {
+		t.Fatalf("expected the last record not to be covered, got %v", err)
+	}
+	if res.Records != 5 || res.Checkpoints != 2 || res.Unsigned != 1 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	signed := append(bytes.Join(lines[:len(lines)-1], []byte("\n")), '\n')
+	if res, err := Verify(bytes.NewReader(signed), []common.Address{cfg.Address}); err != nil || res.Unsigned != 0 {
+		t.Fatalf("expected the log up to the last checkpoint to verify, got %+v, %v", res, err)
+	}
+	if _, err := Verify(bytes.NewReader(nil), []common.Address{cfg.Address}); !errors.Is(err, ErrUnsignedHead) {
+		t.Fatalf("expected a log without checkpoint to fail, got %v", err)
+	}
+
+	other, _ := crypto.GenerateKey()
+	var tamperErr *TamperError
+	if _, err := Verify(bytes.NewReader(data), []common.Address{crypto.PubkeyToAddress(other.PublicKey)}); !errors.As(err, &tamperErr) || tamperErr.Line != 3 {
+		t.Fatalf("expected untrusted checkpoint at line 3, got %v", err)
+	}
+	if _, err := Verify(bytes.NewReader(data), nil); !errors.Is(err, ErrNoTrustedSigners) {
+		t.Fatalf("expected verification without trusted signers to fail, got %v", err)
+	}
+
+	lines[3] = bytes.Replace(lines[3], []byte(`"digest":"0x02"`), []byte(`"digest":"0x07"`), 1)
+	tampered := append(bytes.Join(lines, []byte("\n")), '\n')
+	if _, err := Verify(bytes.NewReader(tampered), []common.Address{cfg.Address}); !errors.As(err, &tamperErr) || tamperErr.Line != 4 {
+		t.Fatalf("expected tampering at line 4, got %v", err)
+	}
+
+	dropped := append(bytes.Join(append(lines[:1:1], lines[2:]...), []byte("\n")), '\n')
+	if _, err := Verify(bytes.NewReader(dropped), []common.Address{cfg.Address}); !errors.As(err, &tamperErr) || tamperErr.Line != 2 {
+		t.Fatalf("expected a gap at line 2, got %v", err)
+	}
+}
+
+func TestChainSinkResume(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	cfg := ChainConfig{Signer: &keySigner{key}, Address: crypto.PubkeyToAddress(key.PublicKey), Interval: 2}
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeChain(t, path, cfg, 2)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a write torn by a crash is dropped
+	if err := os.WriteFile(path, append(common.CopyBytes(data), `{"seq":3,"pr`...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeChain(t, path, cfg, 2)
+	resumed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := Verify(bytes.NewReader(resumed), []common.Address{cfg.Address}); err != nil || res.Records != 4 {
+		t.Fatalf("unexpected result %+v, %v", res, err)
+	}
+
+	// a broken chain is not continued
+	tampered := bytes.Replace(data, []byte(`"digest":"0x01"`), []byte(`"digest":"0x07"`), 1)
+	if err := os.WriteFile(path, tampered, 0600); err != nil {
+		t.Fatal(err)
+	}
+	var tamperErr *TamperError
+	if _, err := NewChainSink(path, cfg); !errors.As(err, &tamperErr) || tamperErr.Line != 2 {
+		t.Fatalf("expected tampering at line 2, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxEntrySize bounds the length of a single line of a chained log.
+const maxEntrySize = 1 << 20
+
+// TamperError reports the first entry of a chained log that failed
+// verification.
+type TamperError struct {
+	Line   int    // 1-based line number in the log
+	Seq    uint64 // sequence number the entry should have
+	Reason string
+}
+
+func (e *TamperError) Error() string {
+	return fmt.Sprintf("audit log tampered at line %d (seq %d): %s", e.Line, e.Seq, e.Reason)
+}
+
+// VerifyResult summarizes a verified chained log.
+type VerifyResult struct {
+	Records     int
+	Checkpoints int
+	// Unsigned is the number of records after the last checkpoint. The chain
+	// alone does not protect them, since whoever rewrites the log can
+	// recompute it.
+	Unsigned int
+	Head     common.Hash
+}
+
+// ErrNoTrustedSigners is returned by Verify when no checkpoint signer is
+// trusted. Accepting any signer would let whoever rewrites the log sign it
+// with a key of their own.
+var ErrNoTrustedSigners = errors.New("no trusted checkpoint signers")
+
+// ErrUnsignedHead is returned by Verify, along with the result, when the log
+// has no checkpoint or records follow the last one.
+var ErrUnsignedHead = errors.New("head of the audit log not covered by a checkpoint")
+
+// Verify walks the chained log read from r, checking the sequence numbers,
+// hashes and checkpoint signatures. Checkpoints must be signed by one of
+// trusted, which must not be empty. The first entry failing verification is
+// reported as a *TamperError, and a valid chain whose head is not signed by a
+// checkpoint fails with ErrUnsignedHead.
+func Verify(r io.Reader, trusted []common.Address) (*VerifyResult, error) {
+	if len(trusted) == 0 {
+		return nil, ErrNoTrustedSigners
+	}
+	allowed := map[common.Address]bool{}
+	for _, addr := range trusted {
+		allowed[addr] = true
+	}
+	res := &VerifyResult{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxEntrySize)
+	var seq uint64
+	for line := 1; scanner.Scan(); line++ {
+		tampered := func(format string, args ...interface{}) error {
+			return &TamperError{Line: line, Seq: seq, Reason: fmt.Sprintf(format, args...)}
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return res, tampered("malformed entry: %v", err)
+		}
+		if reason := e.follows(seq, res.Head); reason != "" {
+			return res, tampered("%s", reason)
+		}
+		switch e.Type {
+		case EntryRecord:
+			var rec Record
+			if err := json.Unmarshal(e.Body, &rec); err != nil {
+				return res, tampered("malformed record: %v", err)
+			}
+			res.Records++
+			res.Unsigned++
+		case EntryCheckpoint:
+			var cp Checkpoint
+			if err := json.Unmarshal(e.Body, &cp); err != nil {
+				return res, tampered("malformed checkpoint: %v", err)
+			}
+			if cp.Head != e.Prev {
+				return res, tampered("checkpoint head %s does not match %s", cp.Head, e.Prev)
+			}
+			if err := verifyCheckpoint(&cp); err != nil {
+				return res, tampered("%v", err)
+			}
+			if !allowed[cp.Address] {
+				return res, tampered("checkpoint signed by untrusted address %s", cp.Address)
+			}
+			res.Checkpoints++
+			res.Unsigned = 0
+		default:
+			return res, tampered("unknown entry type %q", e.Type)
+		}
+		res.Head = e.Hash
+		seq++
+	}
+	if err := scanner.Err(); err != nil {
+		return res, err
+	}
+	if res.Checkpoints == 0 || res.Unsigned > 0 {
+		return res, fmt.Errorf("%w: %d records after the last of %d checkpoints", ErrUnsignedHead, res.Unsigned, res.Checkpoints)
+	}
+	return res, nil
+}
+
+// follows checks that e is the entry with sequence number seq following the
+// entry with hash prev, returning why not otherwise.
+func (e *Entry) follows(seq uint64, prev common.Hash) string {
+	switch {
+	case e.Seq != seq:
+		return fmt.Sprintf("unexpected sequence number %d", e.Seq)
+	case e.Prev != prev:
+		return fmt.Sprintf("previous hash %s does not match %s", e.Prev, prev)
+	case e.computeHash() != e.Hash:
+		return "entry hash mismatch"
+	}
+	return ""
+}
+
+func verifyCheckpoint(cp *Checkpoint) error {
+	if len(cp.Signature) != 65 {
+		return fmt.Errorf("checkpoint signature has length %d", len(cp.Signature))
+	}
+	sig := common.CopyBytes(cp.Signature)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(checkpointDigest(cp.Head), sig)
+	if err != nil {
+		return fmt.Errorf("invalid checkpoint signature: %v", err)
+	}
+	if signer := crypto.PubkeyToAddress(*pub); signer != cp.Address {
+		return fmt.Errorf("checkpoint signed by %s instead of %s", signer, cp.Address)
+	}
+	return nil
+}
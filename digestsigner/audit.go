@@ -0,0 +1,38 @@
+package digestsigner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/wfblockchain/gcp-kms-signer-dlt/audit"
+)
+
+// audit writes the record of a SignDigest or crypto.Signer call to
+// KMSCred.Audit. A signature whose record could not be written is withheld
+// from the caller, so the returned error is only relevant if signErr is nil.
+func (k *KMSSigner) audit(ctx context.Context, op string, address common.Address, keyVersion string, digest, sig []byte, signErr error) error {
+	if k.cfg.Audit == nil {
+		return nil
+	}
+	rec := &audit.Record{
+		Time:       time.Now().UTC(),
+		Operation:  op,
+		Address:    address,
+		KeyVersion: keyVersion,
+		Digest:     common.CopyBytes(digest),
+		Signature:  common.CopyBytes(sig),
+		Metadata:   audit.MetadataFromContext(ctx),
+	}
+	if signErr != nil {
+		rec.Error = signErr.Error()
+	}
+	if err := k.cfg.Audit.Write(ctx, rec); err != nil {
+		log.Error("audit record not written", "address", address, "keyVersion", keyVersion, "err", err)
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package digestsigner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/audit"
+)
+
+type memorySink struct {
+	mu      sync.Mutex
+	records []*audit.Record
+	err     error
+}
+
+func (s *memorySink) Write(ctx context.Context, rec *audit.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, rec)
+	return nil
+}
+
+func TestKMSSignerAudit(t *testing.T) {
+	sink := &memorySink{}
+	cred, _ := newTestCred(t, 1)
+	cred.Audit = sink
+	signer := newTestSigner(t, cred)
+	address := signer.GetAddresses()[0]
+	digest := crypto.Keccak256([]byte("test"))
+
+	ctx := audit.WithMetadata(context.Background(), map[string]string{"request": "r1"})
+	sig, err := signer.SignDigest(ctx, address, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.records) != 1 {
+		t.Fatalf("have %d records, want 1", len(sink.records))
+	}
+	rec := sink.records[0]
+	if rec.Operation != audit.OpSignDigest || rec.Address != address || rec.KeyVersion != signer.ListVersionedKeys()[address] ||
+		string(rec.Digest) != string(digest) || string(rec.Signature) != string(sig) || rec.Metadata["request"] != "r1" {
+		t.Errorf("unexpected record %+v", rec)
+	}
+
+	sink.err = errors.New("disk full")
+	if sig, err := signer.SignDigest(ctx, address, digest); err == nil || sig != nil {
+		t.Fatal("expected the signature to be withheld if the record is not written")
+	}
+}
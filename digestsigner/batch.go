@@ -0,0 +1,72 @@
+package digestsigner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultSignConcurrency is the number of parallel signing calls SignDigests
+// makes when no concurrency is configured.
+const DefaultSignConcurrency = 8
+
+// SignRequest is a digest to sign with the key of Address.
+type SignRequest struct {
+	Address common.Address
+	Digest  []byte
+}
+
+// SignResult is the outcome of a SignRequest. Exactly one of Signature and Err
+// is set.
+type SignResult struct {
+	Signature []byte
+	Err       error
+}
+
+// BatchSigner is implemented by DigestSigners able to sign many digests at
+// once.
+type BatchSigner interface {
+	// SignDigests signs every request and returns the results in the order of
+	// reqs. A failing request does not abort the others.
+	SignDigests(ctx context.Context, reqs []SignRequest) []SignResult
+}
+
+var _ BatchSigner = (*KMSSigner)(nil)
+
+// SignDigests signs reqs with signer, making at most concurrency calls in
+// parallel. The results are in the order of reqs, and a failing request does
+// not abort the others.
+func SignDigests(ctx context.Context, signer DigestSigner, reqs []SignRequest, concurrency int) []SignResult {
+	if concurrency <= 0 {
+		concurrency = DefaultSignConcurrency
+	}
+	results := make([]SignResult, len(reqs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range reqs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			sig, err := signer.SignDigest(ctx, reqs[i].Address, reqs[i].Digest)
+			results[i] = SignResult{Signature: sig, Err: err}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// SignDigests signs every request, with at most KMSCred.SignConcurrency
+// AsymmetricSign calls in flight.
+func (k *KMSSigner) SignDigests(ctx context.Context, reqs []SignRequest) []SignResult {
+	return SignDigests(ctx, k, reqs, k.cfg.SignConcurrency)
+}
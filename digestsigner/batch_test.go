@@ -0,0 +1,86 @@
+package digestsigner
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSignDigests(t *testing.T) {
+	cred, _ := newTestCred(t, 2)
+	cred.SignConcurrency = 3
+	signer := newTestSigner(t, cred)
+	addresses := signer.GetAddresses()
+
+	var reqs []SignRequest
+	for i := 0; i < 10; i++ {
+		reqs = append(reqs, SignRequest{
+			Address: addresses[i%2],
+			Digest:  crypto.Keccak256([]byte{byte(i)}),
+		})
+	}
+	// An unknown address fails on its own without aborting the batch.
+	reqs[4].Address = common.HexToAddress("0x01")
+
+	results := signer.SignDigests(context.Background(), reqs)
+	if len(results) != len(reqs) {
+		t.Fatalf("expected %d results, got %d", len(reqs), len(results))
+	}
+	for i, res := range results {
+		if i == 4 {
+			if res.Err == nil {
+				t.Fatal("expected error for unknown address")
+			}
+			continue
+		}
+		if res.Err != nil {
+			t.Fatalf("request %d failed: %v", i, res.Err)
+		}
+		if !verifyDigest(reqs[i].Address, reqs[i].Digest, res.Signature) {
+			t.Fatalf("signature %d does not match its request", i)
+		}
+	}
+}
+
+// slowSigner tracks how many SignDigest calls run at once.
+type slowSigner struct {
+	*MemorySigner
+	inflight, max int32
+}
+
+func (s *slowSigner) SignDigest(ctx context.Context, address common.Address, digest []byte) ([]byte, error) {
+	n := atomic.AddInt32(&s.inflight, 1)
+	defer atomic.AddInt32(&s.inflight, -1)
+	for {
+		max := atomic.LoadInt32(&s.max)
+		if n <= max || atomic.CompareAndSwapInt32(&s.max, max, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return s.MemorySigner.SignDigest(ctx, address, digest)
+}
+
+func TestSignDigestsConcurrency(t *testing.T) {
+	ms, err := NewMemorySigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &slowSigner{MemorySigner: ms}
+	reqs := make([]SignRequest, 20)
+	for i := range reqs {
+		reqs[i] = SignRequest{Address: ms.GetAddresses()[0], Digest: crypto.Keccak256([]byte{byte(i)})}
+	}
+	for _, res := range SignDigests(context.Background(), signer, reqs, 4) {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	if signer.max > 4 {
+		t.Fatalf("expected at most 4 concurrent calls, got %d", signer.max)
+	}
+}
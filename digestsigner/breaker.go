@@ -0,0 +1,227 @@
+package digestsigner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// ErrCircuitOpen matches every *CircuitOpenError with errors.Is.
+var ErrCircuitOpen = errors.New("kms circuit breaker open")
+
+// CircuitOpenError is returned without calling KMS while the circuit breaker
+// is open.
+type CircuitOpenError struct {
+	Until time.Time // when the breaker lets probe requests through again
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v until %s", ErrCircuitOpen, e.Until.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerConfig configures the circuit breaker around the KMS calls of a
+// KMSSigner. Calls failing with a transient gRPC code or ErrCorrupted, and
+// calls slower than LatencyThreshold, count as failures.
+type BreakerConfig struct {
+	Window           time.Duration // period over which calls are counted, defaults to a minute
+	MinRequests      int           // calls needed in the window before the breaker may open, at least 1
+	ErrorRate        float64       // ratio of failed calls opening the breaker, above 0 and at most 1
+	LatencyThreshold time.Duration // (Optional) calls slower than this count as failures
+	OpenTimeout      time.Duration // how long the breaker stays open before probing, defaults to 30 seconds
+	HalfOpenProbes   int           // successful probes needed to close the breaker again, defaults to 1
+}
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // calls go through
+	BreakerOpen                         // calls fail fast
+	BreakerHalfOpen                     // a limited number of probe calls go through
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+const breakerBuckets = 10
+
+type breakerBucket struct {
+	start           time.Time
+	calls, failures int
+}
+
+type breaker struct {
+	cfg BreakerConfig
+
+	mu        sync.Mutex
+	state     BreakerState
+	buckets   [breakerBuckets]breakerBucket
+	openUntil time.Time
+	probes    int // probes in flight while half-open
+	successes int // successful probes while half-open
+}
+
+// validate rejects configurations with which the breaker would open on any
+// failure or never at all.
+func (c *BreakerConfig) validate() error {
+	if c.MinRequests < 1 {
+		return fmt.Errorf("min requests %d is less than 1", c.MinRequests)
+	}
+	if !(c.ErrorRate > 0 && c.ErrorRate <= 1) {
+		return fmt.Errorf("error rate %v is not in (0, 1]", c.ErrorRate)
+	}
+	return nil
+}
+
+func newBreaker(cfg *BreakerConfig) *breaker {
+	if cfg == nil {
+		return nil
+	}
+	b := &breaker{cfg: *cfg}
+	if b.cfg.Window <= 0 {
+		b.cfg.Window = time.Minute
+	}
+	if b.cfg.OpenTimeout <= 0 {
+		b.cfg.OpenTimeout = 30 * time.Second
+	}
+	if b.cfg.HalfOpenProbes <= 0 {
+		b.cfg.HalfOpenProbes = 1
+	}
+	return b
+}
+
+// do runs call if the breaker allows it and records its outcome.
+func (b *breaker) do(call func() error) error {
+	if b == nil {
+		return call()
+	}
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = call()
+	failed := isBreakerFailure(err) ||
+		(b.cfg.LatencyThreshold > 0 && time.Since(start) > b.cfg.LatencyThreshold)
+	b.record(probe, failed, errors.Is(err, context.Canceled))
+	return err
+}
+
+func (b *breaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.state == BreakerOpen {
+		if now.Before(b.openUntil) {
+			return false, &CircuitOpenError{Until: b.openUntil}
+		}
+		b.state, b.probes, b.successes = BreakerHalfOpen, 0, 0
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes+b.successes >= b.cfg.HalfOpenProbes {
+			return false, &CircuitOpenError{Until: now}
+		}
+		b.probes++
+		return true, nil
+	}
+	return false, nil
+}
+
+func (b *breaker) record(probe, failed, cancelled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if probe {
+		b.probes--
+		if b.state != BreakerHalfOpen || cancelled {
+			return
+		}
+		if failed {
+			b.trip(now)
+			return
+		}
+		if b.successes++; b.successes >= b.cfg.HalfOpenProbes {
+			b.state = BreakerClosed
+			b.buckets = [breakerBuckets]breakerBucket{}
+		}
+		return
+	}
+	if b.state != BreakerClosed || cancelled {
+		return
+	}
+
+	width := b.cfg.Window / breakerBuckets
+	start := now.Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	bucket.calls++
+	if failed {
+		bucket.failures++
+	}
+
+	calls, failures := 0, 0
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.cfg.Window {
+			calls += bucket.calls
+			failures += bucket.failures
+		}
+	}
+	if calls >= b.cfg.MinRequests && float64(failures) >= b.cfg.ErrorRate*float64(calls) && failures > 0 {
+		b.trip(now)
+	}
+}
+
+// trip opens the breaker. It must be called with b.mu held.
+func (b *breaker) trip(now time.Time) {
+	b.state = BreakerOpen
+	b.openUntil = now.Add(b.cfg.OpenTimeout)
+	b.buckets = [breakerBuckets]breakerBucket{}
+}
+
+// status returns the current state, and when an open breaker starts probing.
+func (b *breaker) status() (BreakerState, time.Time) {
+	if b == nil {
+		return BreakerClosed, time.Time{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && !time.Now().Before(b.openUntil) {
+		return BreakerHalfOpen, time.Time{}
+	}
+	return b.state, b.openUntil
+}
+
+// isBreakerFailure reports whether err hints at KMS being degraded, rather
+// than at a problem with the request itself.
+func isBreakerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrRateLimited) {
+		return false
+	}
+	if errors.Is(err, ErrCorrupted) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch grpcCode(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package digestsigner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner/kmstest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreakerOpensOnErrors(t *testing.T) {
+	cred, srv := newTestCred(t, 1)
+	cred.Retry = &RetryPolicy{} // no retries, not even the client's own
+	cred.Breaker = &BreakerConfig{
+		MinRequests: 3, // GetPublicKey during startup counts as well
+		ErrorRate:   0.5,
+		OpenTimeout: 100 * time.Millisecond,
+	}
+	signer := newTestSigner(t, cred)
+	address := signer.GetAddresses()[0]
+	digest := crypto.Keccak256([]byte("test"))
+	ctx := context.Background()
+
+	unavailable := kmstest.Fault{Err: status.Error(codes.Unavailable, "degraded")}
+	srv.InjectFaults("AsymmetricSign", unavailable, unavailable)
+	for i := 0; i < 2; i++ {
+		if _, err := signer.SignDigest(ctx, address, digest); status.Code(err) != codes.Unavailable {
+			t.Fatalf("expected Unavailable, got %v", err)
+		}
+	}
+
+	// The breaker is open: calls fail fast without reaching KMS.
+	calls := srv.Calls("AsymmetricSign")
+	var open *CircuitOpenError
+	if _, err := signer.SignDigest(ctx, address, digest); !errors.As(err, &open) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected CircuitOpenError, got %v", err)
+	}
+	if srv.Calls("AsymmetricSign") != calls {
+		t.Fatal("open breaker let a call through")
+	}
+	if _, err := signer.Status(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected status to report the open breaker, got %v", err)
+	}
+
+	// After the timeout a probe goes through and closes the breaker.
+	time.Sleep(100 * time.Millisecond)
+	if state := signer.BreakerState(); state != BreakerHalfOpen {
+		t.Fatalf("expected half-open breaker, got %s", state)
+	}
+	if _, err := signer.SignDigest(ctx, address, digest); err != nil {
+		t.Fatal(err)
+	}
+	if state := signer.BreakerState(); state != BreakerClosed {
+		t.Fatalf("expected closed breaker, got %s", state)
+	}
+	if _, err := signer.Status(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBreakerOpensOnLatency(t *testing.T) {
+	cred, srv := newTestCred(t, 1)
+	cred.Breaker = &BreakerConfig{
+		MinRequests:      1,
+		ErrorRate:        0.5,
+		LatencyThreshold: 20 * time.Millisecond,
+		OpenTimeout:      time.Minute,
+	}
+	signer := newTestSigner(t, cred)
+	address := signer.GetAddresses()[0]
+	digest := crypto.Keccak256([]byte("test"))
+
+	srv.InjectFaults("AsymmetricSign", kmstest.Fault{Delay: 50 * time.Millisecond})
+	if _, err := signer.SignDigest(context.Background(), address, digest); err != nil {
+		t.Fatal(err)
+	}
+	if state := signer.BreakerState(); state != BreakerOpen {
+		t.Fatalf("expected open breaker, got %s", state)
+	}
+}
+
+func TestBreakerIgnoresRequestErrors(t *testing.T) {
+	cred, srv := newTestCred(t, 1)
+	cred.Retry = &RetryPolicy{}
+	cred.Breaker = &BreakerConfig{MinRequests: 1, ErrorRate: 0.1}
+	signer := newTestSigner(t, cred)
+
+	srv.InjectFaults("AsymmetricSign", kmstest.Fault{Err: status.Error(codes.InvalidArgument, "bad digest")})
+	if _, err := signer.SignDigest(context.Background(), signer.GetAddresses()[0], crypto.Keccak256([]byte("test"))); err == nil {
+		t.Fatal("expected error")
+	}
+	if state := signer.BreakerState(); state != BreakerClosed {
+		t.Fatalf("expected closed breaker, got %s", state)
+	}
+}
+
+func TestBreakerConfigValidation(t *testing.T) {
+	for _, cfg := range []BreakerConfig{
+		{MinRequests: 0, ErrorRate: 0.5},
+		{MinRequests: 10, ErrorRate: 0},
+		{MinRequests: 10, ErrorRate: -0.5},
+		{MinRequests: 10, ErrorRate: 1.5},
+	} {
+		cred, _ := newTestCred(t, 1)
+		cred.Breaker = &cfg
+		if _, err := NewKMSSigner(context.Background(), cred); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package digestsigner
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// keyCache is the on-disk format of the public key cache.
+type keyCache struct {
+	Scope   string          `json:"scope"` // see KMSCred.cacheScope
+	Entries []keyCacheEntry `json:"entries"`
+}
+
+type keyCacheEntry struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"` // empty for P-256 keys
+	Pem       string `json:"pem"`
+	PemCrc32C int64  `json:"pem_crc32c"`
+	Primary   bool   `json:"primary,omitempty"` // primary version of its key when cached
+	Hash      string `json:"hash"`              // hex hmac-sha256 with KMSCred.CacheKey over scope, name, address, pem and primary
+}
+
+// hash returns the HMAC-SHA256 of the entry cached for scope, so that entries
+// rewritten without the key, or copied from a cache of another scope, are
+// detected.
+func (e *keyCacheEntry) hash(key []byte, scope string) string {
+	h := hmac.New(sha256.New, key)
+	for _, field := range []string{scope, e.Name, e.Address, e.Pem, strconv.FormatBool(e.Primary)} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verify checks the integrity of the entry and returns the key it holds.
+func (e *keyCacheEntry) verify(key []byte, scope string) (*publicKey, error) {
+	if int64(crc32c([]byte(e.Pem))) != e.PemCrc32C {
+		return nil, fmt.Errorf("pem crc32c mismatch for %s", e.Name)
+	}
+	if !hmac.Equal([]byte(e.hash(key, scope)), []byte(e.Hash)) {
+		return nil, fmt.Errorf("content hash mismatch for %s", e.Name)
+	}
+	pk, err := ParsePublicKey([]byte(e.Pem))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pem for %s: %w", e.Name, err)
+	}
+	var address common.Address
+	if isSecp256k1(pk) {
+		address = crypto.PubkeyToAddress(*pk)
+		if !common.IsHexAddress(e.Address) || common.HexToAddress(e.Address) != address {
+			return nil, fmt.Errorf("address mismatch for %s", e.Name)
+		}
+	} else if e.Address != "" {
+		return nil, fmt.Errorf("address mismatch for %s", e.Name)
+	}
+	return &publicKey{name: e.Name, pem: e.Pem, pub: pk, address: address, primary: e.Primary}, nil
+}
+
+// readKeyCache returns the keys cached for scope. A missing file or a cache
+// for another scope yields no keys. Any entry failing its integrity checks
+// invalidates the whole cache, since the keys decide where funds are sent.
+func readKeyCache(path, scope string, key []byte) ([]*publicKey, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cache keyCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("malformed cache: %w", err)
+	}
+	if cache.Scope != scope {
+		return nil, nil
+	}
+	keys := make([]*publicKey, 0, len(cache.Entries))
+	for i := range cache.Entries {
+		pk, err := cache.Entries[i].verify(key, scope)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, pk)
+	}
+	return keys, nil
+}
+
+// writeKeyCache atomically replaces the cache at path with keys, checksummed
+// with key.
+func writeKeyCache(path, scope string, key []byte, keys []*publicKey) error {
+	cache := keyCache{Scope: scope, Entries: make([]keyCacheEntry, 0, len(keys))}
+	for _, pk := range keys {
+		entry := keyCacheEntry{
+			Name:      pk.name,
+			Pem:       pk.pem,
+			PemCrc32C: int64(crc32c([]byte(pk.pem))),
+			Primary:   pk.primary,
+		}
+		if isSecp256k1(pk.pub) {
+			entry.Address = pk.address.Hex()
+		}
+		entry.Hash = entry.hash(key, scope)
+		cache.Entries = append(cache.Entries, entry)
+	}
+	data, err := json.MarshalIndent(&cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,96 @@
+package digestsigner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/wfblockchain/gcp-kms-signer-dlt/audit"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner/signature"
+)
+
+// DefaultSignTimeout bounds the signatures made through CryptoSigner if
+// KMSCred.SignTimeout is not set, since crypto.Signer takes no context.
+const DefaultSignTimeout = 30 * time.Second
+
+// KeyVersions returns the names of all loaded key versions, secp256k1 and
+// P-256 ones, primary versions first as in GetAddresses.
+func (k *KMSSigner) KeyVersions() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]string{}, k.versions...)
+}
+
+// CryptoSigner returns a crypto.Signer backed by the loaded key version
+// keyVersion, e.g. a P-256 key for crypto/tls client certificates or ES256
+// JWTs. Its Public method returns an *ecdsa.PublicKey, and Sign returns ASN.1
+// DER signatures of SHA-256 digests. Signing goes through the retries, rate
+// limit, circuit breaker, metrics and audit of the KMSSigner, and stops once
+// it is closed or KMSCred.SignTimeout is over.
+func (k *KMSSigner) CryptoSigner(keyVersion string) (crypto.Signer, error) {
+	k.mu.RLock()
+	key, ok := k.publicKeys[keyVersion]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no key version %s loaded", keyVersion)
+	}
+	return &cryptoSigner{k: k, key: key}, nil
+}
+
+// cryptoSigner adapts a KMS key version to crypto.Signer.
+type cryptoSigner struct {
+	k   *KMSSigner
+	key *publicKey
+}
+
+func (s *cryptoSigner) Public() crypto.PublicKey {
+	return s.key.pub
+}
+
+// Sign signs a SHA-256 digest in KMS. rand is ignored.
+func (s *cryptoSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts == nil || opts.HashFunc() != crypto.SHA256 {
+		return nil, errors.New("only SHA-256 digests can be signed")
+	}
+	if len(digest) != crypto.SHA256.Size() {
+		return nil, fmt.Errorf("digest is %d bytes instead of %d", len(digest), crypto.SHA256.Size())
+	}
+	timeout := s.k.cfg.SignTimeout
+	if timeout <= 0 {
+		timeout = DefaultSignTimeout
+	}
+	ctx, cancel := context.WithTimeout(s.k.ctx, timeout)
+	defer cancel()
+	ctx, span := s.k.startSpan(ctx, "Sign", AttrKeyVersion.String(s.key.name))
+	start := time.Now()
+	sig, err := s.k.asymmetricSign(ctx, s.key.name, digest)
+	if err == nil && !verifyASN1(s.key.pub, digest, sig) {
+		s.k.cfg.Metrics.observeCRCFailure("AsymmetricSign", s.key.name)
+		sig, err = nil, fmt.Errorf("AsymmetricSign: signature %w", ErrCorrupted)
+	}
+	s.k.cfg.Metrics.observeSign(s.key.address, s.key.name, start, err)
+	if aerr := s.k.audit(ctx, audit.OpSign, s.key.address, s.key.name, digest, sig, err); aerr != nil && err == nil {
+		sig, err = nil, aerr
+	}
+	endSpan(span, err)
+	return sig, err
+}
+
+// verifyASN1 checks a DER signature of digest made by pub, which KMS may
+// return with a high S value for secp256k1 keys.
+func verifyASN1(pub *ecdsa.PublicKey, digest, der []byte) bool {
+	if !isSecp256k1(pub) {
+		return ecdsa.VerifyASN1(pub, digest, der)
+	}
+	sig, err := signature.ParseDER(der, signature.Options{})
+	if err != nil {
+		return false
+	}
+	return ethcrypto.VerifySignature(ethcrypto.FromECDSAPub(pub), digest, sig.ToLowS().Compact())
+}
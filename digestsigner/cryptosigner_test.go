@@ -0,0 +1,127 @@
+package digestsigner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/audit"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner/kmstest"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner/signature"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCryptoSigner(t *testing.T) {
+	cred, srv := newTestCred(t, 1)
+	ring := KeyRingRef{ProjectID: cred.ProjectID, Location: cred.Location, KeyRing: cred.KeyRing}
+	tlsKey := ring.name() + "/cryptoKeys/tls"
+	srv.CreateP256Key(tlsKey)
+	p256Version, err := srv.CreateVersion(tlsKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &memorySink{}
+	cred.Key = ""
+	cred.Audit = sink
+	useCache(t, cred)
+	signer := newTestSigner(t, cred)
+
+	if n := len(signer.GetAddresses()); n != 1 {
+		t.Fatalf("expected the P-256 key to have no address, got %d addresses", n)
+	}
+	if n := len(signer.KeyVersions()); n != 2 {
+		t.Fatalf("expected 2 key versions, got %d", n)
+	}
+
+	// a P-256 key signs a self-signed certificate through crypto/x509
+	p256, err := signer.CryptoSigner(p256Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub, ok := p256.Public().(*ecdsa.PublicKey); !ok || pub.Curve != elliptic.P256() {
+		t.Fatalf("unexpected public key %T", p256.Public())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, p256.Public(), p256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		t.Fatal(err)
+	}
+
+	// secp256k1 keys are available as well
+	address := signer.GetAddresses()[0]
+	secp, err := signer.CryptoSigner(signer.ListVersionedKeys()[address])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("test"))
+	sig, err := secp.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := signature.ParseDER(sig, signature.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ethcrypto.VerifySignature(ethcrypto.FromECDSAPub(secp.Public().(*ecdsa.PublicKey)), digest[:], parsed.ToLowS().Compact()) {
+		t.Fatal("invalid secp256k1 signature")
+	}
+	if _, err := secp.Sign(rand.Reader, digest[:20], crypto.SHA1); err == nil {
+		t.Fatal("expected SHA-1 digests to be rejected")
+	}
+
+	sink.mu.Lock()
+	if len(sink.records) != 2 || sink.records[0].Operation != audit.OpSign || sink.records[0].KeyVersion != p256Version {
+		t.Fatalf("unexpected audit records %+v", sink.records)
+	}
+	sink.mu.Unlock()
+
+	// P-256 keys survive the public key cache
+	cached := newTestSigner(t, cred)
+	if n := len(cached.KeyVersions()); n != 2 {
+		t.Fatalf("expected 2 cached key versions, got %d", n)
+	}
+}
+
+func TestCryptoSignerTimeout(t *testing.T) {
+	cred, srv := newTestCred(t, 1)
+	cred.SignTimeout = 50 * time.Millisecond
+	signer := newTestSigner(t, cred)
+	cs, err := signer.CryptoSigner(signer.KeyVersions()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.InjectFaults("AsymmetricSign", kmstest.Fault{Delay: time.Minute})
+	digest := sha256.Sum256([]byte("test"))
+	start := time.Now()
+	if _, err := cs.Sign(rand.Reader, digest[:], crypto.SHA256); !errors.Is(err, context.DeadlineExceeded) && status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("stalled signature took %v", elapsed)
+	}
+}
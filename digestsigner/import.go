@@ -0,0 +1,249 @@
+package digestsigner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/wfblockchain/gcp-kms-signer-dlt/internal/kwp"
+)
+
+// ImportMethodRSAOAEP3072SHA256AES256 is the RSA_OAEP_3072_SHA256_AES_256
+// import method, which the generated kmspb package predates.
+const ImportMethodRSAOAEP3072SHA256AES256 kmspb.ImportJob_ImportMethod = 3
+
+// ErrAddressMismatch is returned by ImportKey if KMS reports a different
+// address for the imported version than the one of the source key.
+var ErrAddressMismatch = errors.New("imported key address mismatch")
+
+// pkcs8 reflects an ASN.1, PKCS #8 PrivateKey. See
+// ftp://ftp.rsasecurity.com/pub/pkcs/pkcs-8/pkcs-8v1_2.asn
+// and RFC 5208.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	// optional attributes omitted.
+}
+
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// MarshalPKCS8PrivateKey encodes a secp256k1 private key as PKCS #8 DER, the
+// format KMS imports keys in. The caller should zero the result once done.
+func MarshalPKCS8PrivateKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	if key.Curve != crypto.S256() {
+		return nil, errors.New("not a secp256k1 private key")
+	}
+	oidBytes, err := asn1.Marshal(OidSecp256k1)
+	if err != nil {
+		return nil, fmt.Errorf("x509: failed to marshal curve OID: %w", err)
+	}
+	privateKey := make([]byte, (key.Curve.Params().N.BitLen()+7)/8)
+	defer zero(privateKey)
+	inner, err := asn1.Marshal(ecPrivateKey{
+		Version:    1,
+		PrivateKey: key.D.FillBytes(privateKey),
+		PublicKey:  asn1.BitString{Bytes: crypto.FromECDSAPub(&key.PublicKey)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("x509: failed to marshal private key: %w", err)
+	}
+	defer zero(inner)
+	der, err := asn1.Marshal(pkcs8{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm:  OidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: oidBytes},
+		},
+		PrivateKey: inner,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("x509: failed to marshal der: %w", err)
+	}
+	return der, nil
+}
+
+// WrapKeyMaterial wraps key material for an import job with the
+// RSA_OAEP_3072_SHA256_AES_256 method: an ephemeral AES-256 key wraps the
+// material with AES-KWP (RFC 5649), and is itself encrypted with RSA-OAEP
+// SHA-256 to the PEM encoded wrapping key of the job.
+func WrapKeyMaterial(wrappingKeyPEM string, material []byte) ([]byte, error) {
+	block, _ := pem.Decode([]byte(wrappingKeyPEM))
+	if block == nil {
+		return nil, errors.New("invalid wrapping key PEM")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapping key: %w", err)
+	}
+	wrappingKey, ok := parsed.(*rsa.PublicKey)
+	if !ok || wrappingKey.N.BitLen() != 3072 {
+		return nil, errors.New("wrapping key is not a 3072 bit RSA key")
+	}
+
+	aesKey := make([]byte, 32)
+	defer zero(aesKey)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, wrappingKey, aesKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := kwp.Wrap(aesKey, material)
+	if err != nil {
+		return nil, err
+	}
+	return append(encryptedKey, wrapped...), nil
+}
+
+// ImportOptions configures ImportKey.
+type ImportOptions struct {
+	ImportJobID     string                // (Optional) import job in the key ring to reuse or create, a new one is created if empty
+	ProtectionLevel kmspb.ProtectionLevel // (Optional) HSM or SOFTWARE, defaults to HSM
+	Labels          map[string]string     // (Optional) labels set on the key if it is created
+}
+
+// ImportKey imports key as a new version of the key named by cred, creating
+// the key ring and an import only key if needed. The key material is only
+// ever held in memory, wrapped locally for the import job. It waits for the
+// version to be enabled, checks its address against the one of key, and
+// returns the credential pinned to the new version along with its address.
+func ImportKey(ctx context.Context, cred *KMSCred, key *ecdsa.PrivateKey, opts ImportOptions) (*KMSCred, common.Address, error) {
+	if cred.ProjectID == "" || cred.Location == "" || cred.KeyRing == "" || cred.Key == "" {
+		return nil, common.Address{}, errors.New("project, location, key ring and key are required")
+	}
+	if opts.ProtectionLevel == kmspb.ProtectionLevel_PROTECTION_LEVEL_UNSPECIFIED {
+		opts.ProtectionLevel = kmspb.ProtectionLevel_HSM
+	}
+	want := crypto.PubkeyToAddress(key.PublicKey)
+	client, err := newKMSClient(ctx, cred)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	defer client.Close()
+
+	if err := ensureKeyRing(ctx, client, cred); err != nil {
+		return nil, common.Address{}, err
+	}
+	provision := ProvisionOptions{ProtectionLevel: opts.ProtectionLevel, Labels: opts.Labels}
+	if err := ensureKey(ctx, client, cred, provision, true); err != nil {
+		return nil, common.Address{}, err
+	}
+	job, err := ensureImportJob(ctx, client, cred, opts)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+
+	material, err := MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	wrapped, err := WrapKeyMaterial(job.GetPublicKey().GetPem(), material)
+	zero(material)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	version, err := client.ImportCryptoKeyVersion(ctx, &kmspb.ImportCryptoKeyVersionRequest{
+		Parent:    cred.keyname(),
+		Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256,
+		ImportJob: job.Name,
+		WrappedKeyMaterial: &kmspb.ImportCryptoKeyVersionRequest_RsaAesWrappedKey{
+			RsaAesWrappedKey: wrapped,
+		},
+	})
+	if err != nil {
+		return nil, common.Address{}, fmt.Errorf("failed to import key version: %w", err)
+	}
+	if err := waitEnabled(ctx, client, version); err != nil {
+		return nil, common.Address{}, err
+	}
+	address, err := versionAddress(ctx, client, version.Name)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	if address != want {
+		return nil, common.Address{}, fmt.Errorf("%w: %s has %s instead of %s", ErrAddressMismatch, version.Name, address, want)
+	}
+	log.Info("Imported key", "version", version.Name, "address", address)
+
+	result := *cred
+	result.KeyVersion = versionID(version.Name)
+	return &result, address, nil
+}
+
+// ensureImportJob returns the active import job named by opts, creating it
+// if needed, and waits for its wrapping key to be generated.
+func ensureImportJob(ctx context.Context, client *kms.KeyManagementClient, cred *KMSCred, opts ImportOptions) (*kmspb.ImportJob, error) {
+	ring := KeyRingRef{ProjectID: cred.ProjectID, Location: cred.Location, KeyRing: cred.KeyRing}
+	id := opts.ImportJobID
+	if id == "" {
+		id = fmt.Sprintf("digestsigner-%d", time.Now().UnixNano())
+	}
+	name := ring.name() + "/importJobs/" + id
+	job, err := client.GetImportJob(ctx, &kmspb.GetImportJobRequest{Name: name})
+	if status.Code(err) == codes.NotFound {
+		job, err = client.CreateImportJob(ctx, &kmspb.CreateImportJobRequest{
+			Parent:      ring.name(),
+			ImportJobId: id,
+			ImportJob: &kmspb.ImportJob{
+				ImportMethod:    ImportMethodRSAOAEP3072SHA256AES256,
+				ProtectionLevel: opts.ProtectionLevel,
+			},
+		})
+		if err == nil {
+			log.Info("Created import job", "name", job.Name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import job: %w", err)
+	}
+	if job.ImportMethod != ImportMethodRSAOAEP3072SHA256AES256 {
+		return nil, fmt.Errorf("import job %s uses unsupported method %s", job.Name, job.ImportMethod)
+	}
+	if job.ProtectionLevel != opts.ProtectionLevel {
+		return nil, fmt.Errorf("import job %s has protection level %s instead of %s", job.Name, job.ProtectionLevel, opts.ProtectionLevel)
+	}
+	for job.State != kmspb.ImportJob_ACTIVE {
+		if job.State != kmspb.ImportJob_PENDING_GENERATION {
+			return nil, fmt.Errorf("import job %s is %s", job.Name, job.State)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("import job %s is still %s: %w", job.Name, job.State, ctx.Err())
+		case <-time.After(500 * time.Millisecond):
+		}
+		if job, err = client.GetImportJob(ctx, &kmspb.GetImportJobRequest{Name: name}); err != nil {
+			return nil, err
+		}
+	}
+	return job, nil
+}
+
+// zero overwrites b, which held key material.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
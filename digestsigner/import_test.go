@@ -0,0 +1,57 @@
+package digestsigner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+func TestImportKey(t *testing.T) {
+	ctx := context.Background()
+	cred, srv := newTestCred(t, 0)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ImportOptions{ImportJobID: "job", ProtectionLevel: kmspb.ProtectionLevel_SOFTWARE}
+
+	imported, address, err := ImportKey(ctx, cred, key, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("unexpected address %s", address)
+	}
+	signer := newTestSigner(t, imported)
+	digest := crypto.Keccak256([]byte("test"))
+	sig, err := signer.SignDigest(ctx, address, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] -= 27
+	if pub, err := crypto.SigToPub(digest, sig); err != nil || crypto.PubkeyToAddress(*pub) != address {
+		t.Fatalf("signature does not recover to the imported address: %v", err)
+	}
+
+	// a second import reuses the key and the import job
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := ImportKey(ctx, cred, other, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.Calls("CreateImportJob") != 1 || srv.Calls("CreateCryptoKey") != 1 {
+		t.Fatal("expected the import job and key to be reused")
+	}
+	if second.KeyVersion == imported.KeyVersion {
+		t.Fatal("expected a new key version")
+	}
+
+	if _, _, err := ImportKey(ctx, cred, other, ImportOptions{ImportJobID: "job", ProtectionLevel: kmspb.ProtectionLevel_HSM}); err == nil {
+		t.Fatal("expected a protection level mismatch to fail")
+	}
+}
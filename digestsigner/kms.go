@@ -2,27 +2,128 @@ package digestsigner
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	kms "cloud.google.com/go/kms/apiv1"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/googleapis/gax-go/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"golang.org/x/oauth2"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
 	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/wfblockchain/gcp-kms-signer-dlt/audit"
 )
 
 type KMSCred struct {
 	ProjectID   string
 	Location    string
 	KeyRing     string
-	Key         string
+	Key         string             // (Optional) if empty, every key in KeyRing and KeyRings is discovered
 	KeyVersion  string             // (Optional) if you want to use a specific key version
 	TokenSource oauth2.TokenSource // (Optional) if you want to use a custom token source, e.g. a service account
+
+	ClientOptions []option.ClientOption // (Optional) extra options for the kms client, e.g. to target a kmstest.Server
+	CachePath     string                // (Optional) file caching public keys between restarts, revalidated against KMS in the background
+	CacheKey      []byte                // (Optional) HMAC-SHA256 key authenticating the cache, required with CachePath and kept outside of it
+
+	KeyRings []KeyRingRef      // (Optional) additional key rings to discover keys in, only used if Key is empty
+	Labels   map[string]string // (Optional) only discover keys carrying all of these labels
+
+	PrimaryVersion string // (Optional) id of the primary version of Key, otherwise the latest enabled version is primary
+	PrimaryLabel   string // (Optional) label of each key holding the id of its primary version, takes precedence over PrimaryVersion
+
+	Retry     *RetryPolicy   // (Optional) retries for AsymmetricSign and GetPublicKey, e.g. DefaultRetryPolicy()
+	RateLimit *RateLimit     // (Optional) client side rate limit of AsymmetricSign calls
+	Breaker   *BreakerConfig // (Optional) circuit breaker failing fast while KMS is degraded
+
+	Metrics        *Metrics             // (Optional) prometheus metrics of signing and key discovery, see NewMetrics
+	TracerProvider trace.TracerProvider // (Optional) provider of the OpenTelemetry spans, defaults to the global one
+
+	Audit audit.Sink // (Optional) receives a record of every SignDigest call, metadata is taken from audit.WithMetadata
+
+	SignConcurrency int           // (Optional) parallel AsymmetricSign calls made by SignDigests, defaults to DefaultSignConcurrency
+	SignTimeout     time.Duration // (Optional) bound of a signature made through CryptoSigner, defaults to DefaultSignTimeout
+
+	RefreshInterval time.Duration   // (Optional) how often to re-list enabled key versions, disabled if zero
+	OnKeysChanged   func(KeyChange) // (Optional) called from the refresher whenever addresses are added or removed
+}
+
+// KeyRingRef identifies a key ring to discover keys in.
+type KeyRingRef struct {
+	ProjectID string
+	Location  string
+	KeyRing   string
+}
+
+func (r *KeyRingRef) name() string {
+	return fmt.Sprintf("projects/%s/locations/%s/keyRings/%s", r.ProjectID, r.Location, r.KeyRing)
+}
+
+func (c *KMSCred) keyRingNames() []string {
+	var names []string
+	if c.KeyRing != "" {
+		names = append(names, (&KeyRingRef{ProjectID: c.ProjectID, Location: c.Location, KeyRing: c.KeyRing}).name())
+	}
+	for i := range c.KeyRings {
+		names = append(names, c.KeyRings[i].name())
+	}
+	return names
+}
+
+// resourcePath describes the scope of the credential: a key version, a key, or
+// a comma separated list of key rings in discovery mode.
+func (c *KMSCred) resourcePath() string {
+	switch {
+	case c.KeyVersion != "":
+		return c.keyversion()
+	case c.Key != "":
+		return c.keyname()
+	default:
+		return strings.Join(c.keyRingNames(), ",")
+	}
+}
+
+// cacheScope describes the keys loaded with the credential, so that a cache
+// written with other filters or primary versions is not used.
+func (c *KMSCred) cacheScope() string {
+	labels := make([]string, 0, len(c.Labels))
+	for name, value := range c.Labels {
+		labels = append(labels, name+"="+value)
+	}
+	sort.Strings(labels)
+	return fmt.Sprintf("%s;labels=%s;primary_version=%s;primary_label=%s", c.resourcePath(), strings.Join(labels, ","), c.PrimaryVersion, c.PrimaryLabel)
+}
+
+func (c *KMSCred) validate() error {
+	if c.Key == "" && c.KeyVersion != "" {
+		return errors.New("key version given without a key")
+	}
+	if c.Key == "" && len(c.keyRingNames()) == 0 {
+		return errors.New("no key or key ring given")
+	}
+	if c.Breaker != nil {
+		if err := c.Breaker.validate(); err != nil {
+			return fmt.Errorf("invalid breaker: %w", err)
+		}
+	}
+	if c.CachePath != "" && len(c.CacheKey) == 0 {
+		return errors.New("cache path given without a cache key")
+	}
+	return nil
 }
 
 func (c *KMSCred) keyname() string {
@@ -33,31 +134,98 @@ func (c *KMSCred) keyversion() string {
 	return fmt.Sprintf("projects/%s/locations/%s/keyRings/%s/cryptoKeys/%s/cryptoKeyVersions/%s", c.ProjectID, c.Location, c.KeyRing, c.Key, c.KeyVersion)
 }
 
+func (c *KMSCred) tracerProvider() trace.TracerProvider {
+	if c.TracerProvider == nil {
+		return otel.GetTracerProvider()
+	}
+	return c.TracerProvider
+}
+
+// newKMSClient creates a KMS client from the token source, client options and
+// tracer provider of cfg.
+func newKMSClient(ctx context.Context, cfg *KMSCred) (*kms.KeyManagementClient, error) {
+	opts := append([]option.ClientOption{}, cfg.ClientOptions...)
+	if cfg.TokenSource != nil {
+		opts = append(opts, option.WithTokenSource(cfg.TokenSource))
+	}
+	opts = append(opts, tracingOption(cfg.tracerProvider()))
+	client, err := kms.NewKeyManagementClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kms client: %w", err)
+	}
+	return client, nil
+}
+
+// KeyChange describes the addresses added to or removed from a KMSSigner by a
+// refresh, each mapped to its key version.
+type KeyChange struct {
+	Added   map[common.Address]string
+	Removed map[common.Address]string
+}
+
 type KMSSigner struct {
-	client           *kms.KeyManagementClient
-	resourcePath     string
+	client       *kms.KeyManagementClient
+	cfg          KMSCred
+	resourcePath string
+	limiter      *rateLimiter
+	breaker      *breaker
+	tracer       trace.Tracer
+
+	mu               sync.RWMutex
 	addressVerionMap map[common.Address]string
+	publicKeys       map[string]*publicKey // key version -> public key
+	addresses        []common.Address      // primary addresses first, see orderKeys
+	versions         []string              // all loaded key versions, including P-256 ones, in the same order
+	primaryOverride  map[string]string     // key -> id of the primary version set by Rotate
+
+	// refreshMu is held from listing the key versions until they are applied,
+	// so that a slow listing never overwrites a newer one.
+	refreshMu sync.Mutex
+
+	// ctx is cancelled on Close to stop background work tracked by wg.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 func NewKMSSigner(ctx context.Context, cfg *KMSCred) (*KMSSigner, error) {
-	client, err := kms.NewKeyManagementClient(ctx, option.WithTokenSource(cfg.TokenSource))
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid kms credential: %w", err)
+	}
+	tp := cfg.tracerProvider()
+	client, err := newKMSClient(ctx, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create kms client: %w", err)
+		return nil, err
 	}
 	s := &KMSSigner{
 		client:           client,
+		cfg:              *cfg,
+		limiter:          newRateLimiter(cfg.RateLimit),
+		breaker:          newBreaker(cfg.Breaker),
+		tracer:           tp.Tracer(instrumentationName),
 		addressVerionMap: map[common.Address]string{},
+		publicKeys:       map[string]*publicKey{},
+		primaryOverride:  map[string]string{},
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 	if err := s.loadAddress(ctx, cfg); err != nil {
+		s.Close()
 		return nil, fmt.Errorf("failed to get addresses: %w", err)
 	}
-	if len(s.addressVerionMap) == 0 {
-		return nil, errors.New("no valid eth private key found")
+	if len(s.KeyVersions()) == 0 {
+		s.Close()
+		return nil, errors.New("no valid signing key found")
+	}
+	if cfg.RefreshInterval > 0 {
+		s.wg.Add(1)
+		go s.refreshLoop(cfg.RefreshInterval)
 	}
 	return s, nil
 }
 
 func (s *KMSSigner) HasAddress(addr common.Address) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	_, ok := s.addressVerionMap[addr]
 	return ok
 }
@@ -70,15 +238,42 @@ func (s *KMSSigner) GetConnectionStatus() string {
 	return s.client.Connection().GetState().String()
 }
 
-func (k *KMSSigner) GetAddresses() []common.Address {
-	addresses := make([]common.Address, 0, len(k.addressVerionMap))
-	for k := range k.addressVerionMap {
-		addresses = append(addresses, k)
+// Status returns the state of the underlying gRPC connection and of the
+// circuit breaker, or an error if the signer is currently unusable.
+func (s *KMSSigner) Status() (string, error) {
+	state := s.GetConnectionStatus()
+	if state == "INVALID_STATE" {
+		return "", fmt.Errorf("invalid state")
+	}
+	if s.breaker == nil {
+		return state, nil
+	}
+	bs, until := s.breaker.status()
+	state = fmt.Sprintf("%s, circuit %s", state, bs)
+	if bs == BreakerOpen {
+		return state, &CircuitOpenError{Until: until}
 	}
-	return addresses
+	return state, nil
+}
+
+// BreakerState returns the state of the circuit breaker, which is always
+// closed if no breaker is configured.
+func (s *KMSSigner) BreakerState() BreakerState {
+	state, _ := s.breaker.status()
+	return state
+}
+
+// GetAddresses returns the loaded addresses, the primary version of every key
+// first, ordered by key name.
+func (k *KMSSigner) GetAddresses() []common.Address {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]common.Address{}, k.addresses...)
 }
 
 func (k *KMSSigner) ListVersionedKeys() map[common.Address]string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	result := map[common.Address]string{}
 	for k, v := range k.addressVerionMap {
 		result[k] = v
@@ -86,70 +281,266 @@ func (k *KMSSigner) ListVersionedKeys() map[common.Address]string {
 	return result
 }
 
+func (k *KMSSigner) KeyVersion(addr common.Address) (string, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keyVersion, ok := k.addressVerionMap[addr]
+	return keyVersion, ok
+}
+
 func (k *KMSSigner) SignDigest(ctx context.Context, address common.Address, digest []byte) ([]byte, error) {
+	k.mu.RLock()
 	keyVersion, ok := k.addressVerionMap[address]
+	pub := k.publicKeys[keyVersion]
+	k.mu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("no eth private key found for address %s", address)
 	}
 
-	digestCRC32C := crc32c(digest)
-	req := &kmspb.AsymmetricSignRequest{
-		Name: keyVersion,
-		Digest: &kmspb.Digest{
-			Digest: &kmspb.Digest_Sha256{
-				Sha256: digest,
-			},
-		},
-		DigestCrc32C: wrapperspb.Int64(int64(digestCRC32C)),
+	ctx, span := k.startSpan(ctx, "SignDigest", AttrAddress.String(address.Hex()), AttrKeyVersion.String(keyVersion))
+	start := time.Now()
+	sig, err := k.signDigest(ctx, pub, digest)
+	k.cfg.Metrics.observeSign(address, keyVersion, start, err)
+	if aerr := k.audit(ctx, audit.OpSignDigest, address, keyVersion, digest, sig, err); aerr != nil && err == nil {
+		sig, err = nil, aerr
 	}
+	endSpan(span, err)
+	return sig, err
+}
 
-	// Call the API.
-	result, err := k.client.AsymmetricSign(ctx, req)
+func (k *KMSSigner) signDigest(ctx context.Context, pub *publicKey, digest []byte) ([]byte, error) {
+	signature, err := k.asymmetricSign(ctx, pub.name, digest)
 	if err != nil {
 		return nil, err
 	}
-	if !result.VerifiedDigestCrc32C {
-		return nil, fmt.Errorf("AsymmetricSign: request corrupted in-transit")
-	}
-
-	if int64(crc32c(result.Signature)) != result.SignatureCrc32C.Value {
-		return nil, fmt.Errorf("AsymmetricSign: response corrupted in-transit")
-	}
 
 	// recover R and S from the signature
-	r, s, err := recoverRS(result.Signature)
+	r, s, err := recoverRS(signature)
 	if err != nil {
 		return nil, err
 	}
 
+	_, span := k.startSpan(ctx, "RecoverV", AttrKeyVersion.String(pub.name))
+	v, err := recoveryID(pub.pub, digest, r, s)
+	endSpan(span, err)
+	if err != nil {
+		k.cfg.Metrics.observeRecoveryFailure(pub.address, pub.name)
+		return nil, fmt.Errorf("AsymmetricSign: signature failed, unable to determine V: %w", err)
+	}
+
 	// Reconstruct the eth signature R || S || V
 	sig := make([]byte, 65)
-	copy(sig[:32], r.Bytes())
-	copy(sig[32:64], s.Bytes())
-	sig[64] = 0x1b
-
-	// TODO: is ther a better way to determine the value of V?
-	if !verifyDigest(address, digest, sig) {
-		sig[64]++
-		if !verifyDigest(address, digest, sig) {
-			return nil, fmt.Errorf("AsymmetricSign: signature failed, unable to determine V")
-		}
-	}
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:64])
+	sig[64] = 27 + v
 
 	return sig, nil
 }
 
+// QueueDepth returns the number of signing requests currently waiting for the
+// rate limiter.
+func (k *KMSSigner) QueueDepth() int {
+	return k.limiter.queueDepth()
+}
+
 func (l *KMSSigner) Close() error {
+	l.cancel()
+	l.wg.Wait()
 	return l.client.Close()
 }
 
+// supportedAlgorithms are the algorithms of the key versions loaded by a
+// KMSSigner. Only secp256k1 versions have an address and sign digests, P-256
+// ones are only available through CryptoSigner.
+var supportedAlgorithms = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]bool{
+	kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256: true,
+	kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256:      true,
+}
+
+// publicKey is the public half of a KMS key version.
+type publicKey struct {
+	name    string
+	pem     string
+	pub     *ecdsa.PublicKey
+	address common.Address // zero for P-256 keys
+	primary bool           // whether this is the primary version of its key
+}
+
 func (k *KMSSigner) loadAddress(ctx context.Context, cfg *KMSCred) error {
-	if cfg.KeyVersion == "" {
-		keyName := cfg.keyname()
-		k.resourcePath = keyName
-		it := k.client.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{
-			Parent: keyName,
-			Filter: "state=ENABLED AND algorithm=EC_SIGN_SECP256K1_SHA256",
+	k.resourcePath = cfg.resourcePath()
+	if cfg.CachePath != "" {
+		keys, err := readKeyCache(cfg.CachePath, cfg.cacheScope(), cfg.CacheKey)
+		if err != nil {
+			log.Warn("Ignoring public key cache", "path", cfg.CachePath, "err", err)
+		} else if len(keys) > 0 {
+			k.setKeys(k.markCachedPrimary(keys))
+			k.wg.Add(1)
+			go k.revalidate()
+			return nil
+		}
+	}
+	keys, err := k.fetchKeys(ctx, nil)
+	if err != nil {
+		return err
+	}
+	k.setKeys(keys)
+	k.writeCache(keys)
+	return nil
+}
+
+// Refresh re-lists the enabled key versions in KMS and atomically replaces the
+// loaded addresses with them. Versions that are already loaded are not fetched
+// again, since the key material of a version never changes.
+func (k *KMSSigner) Refresh(ctx context.Context) error {
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+	k.mu.RLock()
+	known := k.publicKeys
+	k.mu.RUnlock()
+	keys, err := k.fetchKeys(ctx, known)
+	if err != nil {
+		return err
+	}
+	k.applyKeys(keys)
+	return nil
+}
+
+func (k *KMSSigner) refreshLoop(interval time.Duration) {
+	defer k.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(k.ctx, interval)
+		if err := k.Refresh(ctx); err != nil {
+			log.Warn("Failed to refresh key versions", "resource", k.resourcePath, "err", err)
+		}
+		cancel()
+	}
+}
+
+// applyKeys replaces the loaded keys, persists them and notifies the change
+// callback. The caller holds refreshMu since fetching the keys.
+func (k *KMSSigner) applyKeys(keys []*publicKey) KeyChange {
+	before := k.KeyVersions()
+	added, removed := k.setKeys(keys)
+	change := KeyChange{Added: added, Removed: removed}
+	if len(added) > 0 || len(removed) > 0 || !sameStrings(before, k.KeyVersions()) {
+		k.writeCache(keys) // the primary versions may have changed as well
+	}
+	if (len(added) > 0 || len(removed) > 0) && k.cfg.OnKeysChanged != nil {
+		k.cfg.OnKeysChanged(change)
+	}
+	return change
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// revalidate replaces the keys loaded from the cache with the ones currently
+// in KMS, retrying until KMS is reachable or the signer is closed.
+func (k *KMSSigner) revalidate() {
+	defer k.wg.Done()
+	delay := time.Second
+	for {
+		ctx, cancel := context.WithTimeout(k.ctx, time.Minute)
+		change, err := k.reload(ctx)
+		cancel()
+		if err == nil {
+			for addr, name := range change.Removed {
+				log.Warn("Dropped cached key not confirmed by KMS", "address", addr, "key", name)
+			}
+			for addr, name := range change.Added {
+				log.Info("Loaded key missing from cache", "address", addr, "key", name)
+			}
+			return
+		}
+		log.Warn("Failed to revalidate cached public keys", "err", err, "retry", delay)
+		select {
+		case <-k.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
+
+// reload replaces the loaded keys with the ones currently in KMS, fetching
+// all of them again.
+func (k *KMSSigner) reload(ctx context.Context) (KeyChange, error) {
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+	keys, err := k.fetchKeys(ctx, nil)
+	if err != nil {
+		return KeyChange{}, err
+	}
+	return k.applyKeys(keys), nil
+}
+
+func (k *KMSSigner) writeCache(keys []*publicKey) {
+	if k.cfg.CachePath == "" {
+		return
+	}
+	if err := writeKeyCache(k.cfg.CachePath, k.cfg.cacheScope(), k.cfg.CacheKey, keys); err != nil {
+		log.Warn("Failed to write public key cache", "path", k.cfg.CachePath, "err", err)
+	}
+}
+
+// fetchKeys lists the public keys of all usable key versions in KMS. Public
+// keys of versions present in known are reused instead of fetched.
+func (k *KMSSigner) fetchKeys(ctx context.Context, known map[string]*publicKey) ([]*publicKey, error) {
+	defer k.cfg.Metrics.observeDiscovery(time.Now())
+	cfg := &k.cfg
+	switch {
+	case cfg.KeyVersion != "":
+		version, err := k.client.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{
+			Name: cfg.keyversion(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if version.State != kmspb.CryptoKeyVersion_ENABLED {
+			return nil, nil
+		}
+		key, ok := known[version.Name]
+		if !ok {
+			if key, err = k.getPublicKey(ctx, version.Name); err != nil {
+				return nil, err
+			}
+		}
+		return markPrimary([]*publicKey{key}, ""), nil
+	case cfg.Key != "":
+		var labels map[string]string
+		if cfg.PrimaryLabel != "" {
+			key, err := k.client.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: cfg.keyname()})
+			if err != nil {
+				return nil, err
+			}
+			labels = key.GetLabels()
+		}
+		return k.fetchKeyVersions(ctx, cfg.keyname(), labels, known)
+	}
+
+	var keys []*publicKey
+	for _, keyRing := range cfg.keyRingNames() {
+		it := k.client.ListCryptoKeys(ctx, &kmspb.ListCryptoKeysRequest{
+			Parent: keyRing,
+			Filter: "purpose=ASYMMETRIC_SIGN",
 		})
 		for {
 			resp, err := it.Next()
@@ -157,30 +548,195 @@ func (k *KMSSigner) loadAddress(ctx context.Context, cfg *KMSCred) error {
 				break
 			}
 			if err != nil {
-				return err
+				return nil, err
 			}
-			if err := k.setAddress(ctx, resp.GetName()); err != nil {
-				return err
+			if !hasLabels(resp.GetLabels(), cfg.Labels) {
+				continue
 			}
+			found, err := k.fetchKeyVersions(ctx, resp.GetName(), resp.GetLabels(), known)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, found...)
 		}
-	} else {
-		k.resourcePath = cfg.keyversion()
-		return k.setAddress(ctx, cfg.keyversion())
 	}
-	return nil
+	return keys, nil
+}
+
+// fetchKeyVersions lists the public keys of the usable versions of keyName,
+// marking the primary one according to the labels of the key.
+func (k *KMSSigner) fetchKeyVersions(ctx context.Context, keyName string, labels map[string]string, known map[string]*publicKey) (_ []*publicKey, err error) {
+	ctx, span := k.startSpan(ctx, "ListCryptoKeyVersions", attribute.String("kms.key", keyName))
+	defer func() { endSpan(span, err) }()
+
+	var keys []*publicKey
+	it := k.client.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{
+		Parent: keyName,
+		Filter: "state=ENABLED",
+	})
+	for {
+		resp, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !supportedAlgorithms[resp.GetAlgorithm()] {
+			continue
+		}
+		if key, ok := known[resp.GetName()]; ok {
+			keys = append(keys, key)
+			continue
+		}
+		key, err := k.getPublicKey(ctx, resp.GetName())
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return markPrimary(keys, k.primaryVersion(keyName, labels)), nil
+}
+
+func hasLabels(labels, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
 }
 
-func (k *KMSSigner) setAddress(ctx context.Context, key string) error {
-	resp, err := k.client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{
-		Name: key,
+func (k *KMSSigner) getPublicKey(ctx context.Context, name string) (_ *publicKey, err error) {
+	ctx, span := k.startSpan(ctx, "GetPublicKey", AttrKeyVersion.String(name))
+	defer func() { endSpan(span, err) }()
+
+	var resp *kmspb.PublicKey
+	err = k.cfg.Retry.do(ctx, "GetPublicKey", name, func(ctx context.Context) error {
+		return k.breaker.do(func() error {
+			var err error
+			resp, err = k.client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{
+				Name: name,
+			}, k.callOptions()...)
+			if err != nil {
+				return err
+			}
+			if resp.PemCrc32C != nil && int64(crc32c([]byte(resp.Pem))) != resp.PemCrc32C.Value {
+				k.cfg.Metrics.observeCRCFailure("GetPublicKey", name)
+				return fmt.Errorf("GetPublicKey: response %w", ErrCorrupted)
+			}
+			return nil
+		})
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	pk, err := PemToPubkey(resp.Pem)
+	pk, err := ParsePublicKey([]byte(resp.Pem))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	k.addressVerionMap[crypto.PubkeyToAddress(*pk)] = key
-	return nil
+	key := &publicKey{name: name, pem: resp.Pem, pub: pk}
+	if isSecp256k1(pk) {
+		key.address = crypto.PubkeyToAddress(*pk)
+	}
+	return key, nil
+}
+
+// asymmetricSign asks KMS to sign digest with keyVersion and returns the DER
+// encoded signature, after checking the integrity of request and response.
+func (k *KMSSigner) asymmetricSign(ctx context.Context, keyVersion string, digest []byte) (_ []byte, err error) {
+	ctx, span := k.startSpan(ctx, "AsymmetricSign", AttrKeyVersion.String(keyVersion))
+	defer func() { endSpan(span, err) }()
+
+	digestCRC32C := crc32c(digest)
+	req := &kmspb.AsymmetricSignRequest{
+		Name: keyVersion,
+		Digest: &kmspb.Digest{
+			Digest: &kmspb.Digest_Sha256{
+				Sha256: digest,
+			},
+		},
+		DigestCrc32C: wrapperspb.Int64(int64(digestCRC32C)),
+	}
+
+	var result *kmspb.AsymmetricSignResponse
+	err = k.cfg.Retry.do(ctx, "AsymmetricSign", keyVersion, func(ctx context.Context) error {
+		if err := k.limiter.wait(ctx, keyVersion); err != nil {
+			return err
+		}
+		return k.breaker.do(func() error {
+			// Call the API.
+			var err error
+			result, err = k.client.AsymmetricSign(ctx, req, k.callOptions()...)
+			if err != nil {
+				return err
+			}
+			if !result.VerifiedDigestCrc32C || result.Name != keyVersion {
+				k.cfg.Metrics.observeCRCFailure("AsymmetricSign", keyVersion)
+				return fmt.Errorf("AsymmetricSign: request %w", ErrCorrupted)
+			}
+			if int64(crc32c(result.Signature)) != result.GetSignatureCrc32C().GetValue() {
+				k.cfg.Metrics.observeCRCFailure("AsymmetricSign", keyVersion)
+				return fmt.Errorf("AsymmetricSign: response %w", ErrCorrupted)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Signature, nil
+}
+
+// callOptions disables the retries built into the KMS client when a
+// RetryPolicy is configured, so that every attempt goes through the policy.
+func (k *KMSSigner) callOptions() []gax.CallOption {
+	if k.cfg.Retry == nil {
+		return nil
+	}
+	return []gax.CallOption{gax.WithRetry(func() gax.Retryer { return nil })}
+}
+
+// setKeys replaces the loaded keys and reports which addresses were added or
+// removed, along with their key version.
+func (k *KMSSigner) setKeys(keys []*publicKey) (added, removed map[common.Address]string) {
+	keys = orderKeys(keys)
+	order := make([]common.Address, 0, len(keys))
+	versions := make([]string, 0, len(keys))
+	addresses := make(map[common.Address]string, len(keys))
+	publicKeys := make(map[string]*publicKey, len(keys))
+	for _, key := range keys {
+		publicKeys[key.name] = key
+		versions = append(versions, key.name)
+		if !isSecp256k1(key.pub) {
+			continue // no address
+		}
+		if _, ok := addresses[key.address]; ok {
+			continue // the same key material in several versions, prefer the first
+		}
+		order = append(order, key.address)
+		addresses[key.address] = key.name
+	}
+
+	k.mu.Lock()
+	old := k.addressVerionMap
+	k.addressVerionMap = addresses
+	k.publicKeys = publicKeys
+	k.addresses = order
+	k.versions = versions
+	k.mu.Unlock()
+	k.cfg.Metrics.setLoadedAddresses(k.resourcePath, len(addresses))
+
+	added, removed = map[common.Address]string{}, map[common.Address]string{}
+	for addr, name := range addresses {
+		if old[addr] != name {
+			added[addr] = name
+		}
+	}
+	for addr, name := range old {
+		if addresses[addr] != name {
+			removed[addr] = name
+		}
+	}
+	return added, removed
 }
@@ -1,28 +1,67 @@
 package digestsigner
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner/kmstest"
+	"google.golang.org/api/option"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc"
 )
 
-var (
-	cred = &KMSCred{
-		ProjectID: "certain-math-353822",
-		Location:  "us-east4",
-		KeyRing:   "wf_test",
-		Key:       "anvil_test_secp256k1",
-		// KeyVersion: "1",
+// newTestCred starts a fake KMS with versions enabled key versions on the test
+// key and returns credentials pointing at it.
+func newTestCred(t testing.TB, versions int) (*KMSCred, *kmstest.Server) {
+	t.Helper()
+	srv, err := kmstest.NewServer()
+	if err != nil {
+		t.Fatal(err)
 	}
-)
+	t.Cleanup(srv.Close)
+	cred := &KMSCred{
+		ProjectID:     "certain-math-353822",
+		Location:      "us-east4",
+		KeyRing:       "wf_test",
+		Key:           "anvil_test_secp256k1",
+		ClientOptions: srv.ClientOptions(),
+	}
+	for i := 0; i < versions; i++ {
+		if _, err := srv.CreateVersion(cred.keyname()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cred, srv
+}
+
+func newTestSigner(t testing.TB, cred *KMSCred) *KMSSigner {
+	t.Helper()
+	signer, err := NewKMSSigner(context.Background(), cred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { signer.Close() })
+	return signer
+}
 
 func TestKMSSigner(t *testing.T) {
 	ctx := context.Background()
+	cred, _ := newTestCred(t, 2)
 
-	signer, err := NewKMSSigner(ctx, cred)
-	if err != nil {
-		t.Fatal(err)
+	signer := newTestSigner(t, cred)
+	if n := len(signer.GetAddresses()); n != 2 {
+		t.Fatalf("expected 2 addresses, got %d", n)
 	}
 	for _, address := range signer.GetAddresses() {
 		t.Logf("Signing digest using address %s", address)
@@ -37,3 +76,333 @@ func TestKMSSigner(t *testing.T) {
 		}
 	}
 }
+
+func TestKMSSignerHighS(t *testing.T) {
+	ctx := context.Background()
+	cred, srv := newTestCred(t, 1)
+	signer := newTestSigner(t, cred)
+	address := signer.GetAddresses()[0]
+	halfN := new(big.Int).Rsh(crypto.S256().Params().N, 1)
+
+	seen := map[byte]bool{}
+	for i := 0; i < 16; i++ {
+		digest := crypto.Keccak256([]byte{byte(i)})
+		srv.SetHighS(false)
+		low, err := signer.SignDigest(ctx, address, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// KMS returning N-S flips the recovery id, which must be undone
+		srv.SetHighS(true)
+		high, err := signer.SignDigest(ctx, address, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(high, low) {
+			t.Fatalf("signature of high S %x differs from %x", high, low)
+		}
+		if new(big.Int).SetBytes(high[32:64]).Cmp(halfN) > 0 || !verifyDigest(address, digest, high) {
+			t.Fatalf("invalid signature %x", high)
+		}
+		seen[high[64]] = true
+	}
+	if !seen[27] || !seen[28] {
+		t.Fatalf("expected both recovery ids, got %v", seen)
+	}
+}
+
+func TestKMSSignerSkipsDisabledVersions(t *testing.T) {
+	cred, srv := newTestCred(t, 3)
+	disabled := srv.Versions(cred.keyname())[1]
+	if err := srv.SetState(disabled, kmspb.CryptoKeyVersion_DISABLED); err != nil {
+		t.Fatal(err)
+	}
+
+	signer := newTestSigner(t, cred)
+	keys := signer.ListVersionedKeys()
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(keys))
+	}
+	for _, name := range keys {
+		if name == disabled {
+			t.Fatalf("disabled version %s was loaded", name)
+		}
+	}
+}
+
+func TestKMSSignerKeyVersion(t *testing.T) {
+	cred, srv := newTestCred(t, 2)
+	cred.KeyVersion = "2"
+
+	signer := newTestSigner(t, cred)
+	key, err := srv.PrivateKey(cred.keyversion())
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	if !signer.HasAddress(address) || len(signer.GetAddresses()) != 1 {
+		t.Fatalf("expected only address %s, got %v", address, signer.GetAddresses())
+	}
+	if signer.ResourcePath() != cred.keyversion() {
+		t.Fatalf("unexpected resource path %s", signer.ResourcePath())
+	}
+}
+
+func TestKMSSignerNoKeys(t *testing.T) {
+	cred, _ := newTestCred(t, 0)
+	if _, err := NewKMSSigner(context.Background(), cred); err == nil {
+		t.Fatal("expected error for a key without versions")
+	}
+}
+
+func TestKMSSignerCache(t *testing.T) {
+	cred, srv := newTestCred(t, 2)
+	useCache(t, cred)
+
+	want := newTestSigner(t, cred).ListVersionedKeys()
+
+	// With KMS gone, the signer still comes up from the cache.
+	srv.Close()
+	got := newTestSigner(t, cred).ListVersionedKeys()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("cached keys mismatch: have %v, want %v", got, want)
+	}
+}
+
+func TestKMSSignerCacheTampered(t *testing.T) {
+	cred, srv := newTestCred(t, 1)
+	useCache(t, cred)
+	newTestSigner(t, cred)
+
+	data, err := os.ReadFile(cred.CachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cache keyCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		t.Fatal(err)
+	}
+	cache.Entries[0].Address = common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03").Hex()
+	if data, err = json.Marshal(&cache); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cred.CachePath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tampered cache is rejected, and without KMS there is nothing to load.
+	srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := NewKMSSigner(ctx, cred); err == nil {
+		t.Fatal("expected tampered cache to be rejected")
+	}
+}
+
+func TestKMSSignerCacheKey(t *testing.T) {
+	cred, srv := newTestCred(t, 1)
+	useCache(t, cred)
+	newTestSigner(t, cred)
+	data, err := os.ReadFile(cred.CachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	// An entry rewritten with a consistent checksum is rejected without the key.
+	var cache keyCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := crypto.GenerateKey()
+	pemString, err := PubkeyToPem(&other.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &cache.Entries[0]
+	entry.Pem, entry.PemCrc32C = pemString, int64(crc32c([]byte(pemString)))
+	entry.Address = crypto.PubkeyToAddress(other.PublicKey).Hex()
+	entry.Hash = entry.hash([]byte("other key"), cache.Scope)
+	rewritten, err := json.Marshal(&cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cred.CachePath, rewritten, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readKeyCache(cred.CachePath, cred.cacheScope(), cred.CacheKey); err == nil {
+		t.Fatal("expected rewritten cache to be rejected")
+	}
+
+	// A cache written with other key filters is not used.
+	if err := os.WriteFile(cred.CachePath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cred.PrimaryVersion = "1"
+	if keys, err := readKeyCache(cred.CachePath, cred.cacheScope(), cred.CacheKey); err != nil || len(keys) != 0 {
+		t.Fatalf("expected no keys for another scope, got %v, %v", keys, err)
+	}
+
+	cred.CacheKey = nil
+	if _, err := NewKMSSigner(context.Background(), cred); err == nil {
+		t.Fatal("expected a cache without key to be refused")
+	}
+}
+
+func TestKMSSignerCacheRevalidation(t *testing.T) {
+	cred, srv := newTestCred(t, 2)
+	useCache(t, cred)
+	newTestSigner(t, cred)
+
+	disabled := srv.Versions(cred.keyname())[0]
+	if err := srv.SetState(disabled, kmspb.CryptoKeyVersion_DISABLED); err != nil {
+		t.Fatal(err)
+	}
+	signer := newTestSigner(t, cred)
+	waitFor(t, func() bool { return len(signer.GetAddresses()) == 1 })
+	for _, name := range signer.ListVersionedKeys() {
+		if name == disabled {
+			t.Fatalf("disabled version %s survived revalidation", name)
+		}
+	}
+}
+
+// useCache makes cred cache its public keys in a temporary file.
+func useCache(t testing.TB, cred *KMSCred) {
+	cred.CachePath = filepath.Join(t.TempDir(), "keys.json")
+	cred.CacheKey = []byte("cache key")
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestKMSSignerRefresh(t *testing.T) {
+	cred, srv := newTestCred(t, 1)
+	changes := make(chan KeyChange, 4)
+	cred.RefreshInterval = 10 * time.Millisecond
+	cred.OnKeysChanged = func(c KeyChange) { changes <- c }
+	signer := newTestSigner(t, cred)
+	old := signer.GetAddresses()[0]
+
+	// Keep signing while the refresher swaps the keys underneath.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		digest := crypto.Keccak256([]byte("test"))
+		for ctx.Err() == nil {
+			signer.SignDigest(ctx, old, digest)
+		}
+	}()
+
+	added, err := srv.CreateVersion(cred.keyname())
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := <-changes
+	if len(change.Added) != 1 || len(change.Removed) != 0 {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	for _, name := range change.Added {
+		if name != added {
+			t.Fatalf("expected %s to be added, got %s", added, name)
+		}
+	}
+
+	if err := srv.SetState(signer.ListVersionedKeys()[old], kmspb.CryptoKeyVersion_DISABLED); err != nil {
+		t.Fatal(err)
+	}
+	change = <-changes
+	if _, ok := change.Removed[old]; !ok || len(change.Added) != 0 {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	if signer.HasAddress(old) {
+		t.Fatalf("disabled address %s still loaded", old)
+	}
+}
+
+func TestKMSSignerConcurrentRefresh(t *testing.T) {
+	ctx := context.Background()
+	cred, srv := newTestCred(t, 1)
+	old := srv.Versions(cred.keyname())[0]
+	var stalled int32
+	stalling := make(chan struct{})
+	cred.ClientOptions = append(cred.ClientOptions, option.WithGRPCDialOption(grpc.WithUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if strings.HasSuffix(method, "/GetPublicKey") && req.(*kmspb.GetPublicKeyRequest).Name != old {
+				if atomic.CompareAndSwapInt32(&stalled, 0, 1) {
+					close(stalling)
+					time.Sleep(150 * time.Millisecond)
+				}
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})))
+	cred.RefreshInterval = 300 * time.Millisecond
+	signer := newTestSigner(t, cred)
+
+	// the refresher lists both versions, then stalls fetching the new one
+	added, err := srv.CreateVersion(cred.keyname())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-stalling
+	if err := srv.SetState(old, kmspb.CryptoKeyVersion_DISABLED); err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond) // until the stalled refresh is over
+	if keys := signer.ListVersionedKeys(); len(keys) != 1 || keys[signer.GetAddresses()[0]] != added {
+		t.Fatalf("expected only %s to be loaded, got %v", added, keys)
+	}
+}
+
+func TestKMSSignerDiscovery(t *testing.T) {
+	cred, srv := newTestCred(t, 0)
+	cred.Key = ""
+	cred.KeyRings = []KeyRingRef{{ProjectID: "other-project", Location: "europe-west1", KeyRing: "hot"}}
+	cred.Labels = map[string]string{"role": "hot-wallet"}
+
+	ring := cred.keyRingNames()[0]
+	other := cred.KeyRings[0].name()
+	want := map[string]bool{}
+	for _, key := range []struct {
+		name   string
+		labels map[string]string
+	}{
+		{ring + "/cryptoKeys/wallet-1", map[string]string{"role": "hot-wallet"}},
+		{ring + "/cryptoKeys/wallet-2", map[string]string{"role": "hot-wallet", "team": "payouts"}},
+		{ring + "/cryptoKeys/cold", map[string]string{"role": "cold-wallet"}},
+		{ring + "/cryptoKeys/unlabeled", nil},
+		{other + "/cryptoKeys/wallet-3", map[string]string{"role": "hot-wallet"}},
+	} {
+		srv.CreateKey(key.name, key.labels)
+		name, err := srv.CreateVersion(key.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[name] = key.labels["role"] == "hot-wallet"
+	}
+
+	signer := newTestSigner(t, cred)
+	got := map[string]bool{}
+	for _, name := range signer.ListVersionedKeys() {
+		got[name] = true
+	}
+	for name, loaded := range want {
+		if got[name] != loaded {
+			t.Errorf("key version %s: loaded %v, want %v", name, got[name], loaded)
+		}
+	}
+	if path := signer.ResourcePath(); path != ring+","+other {
+		t.Errorf("unexpected resource path %s", path)
+	}
+}
@@ -0,0 +1,756 @@
+// Package kmstest provides an in-process fake of the Cloud KMS
+// KeyManagementService for hermetic tests of digestsigner.
+//
+// The fake implements the subset of the API used by digestsigner and is backed
+// by secp256k1 and P-256 keys generated locally. It is not safe for anything but tests.
+package kmstest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+	"google.golang.org/api/option"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/wfblockchain/gcp-kms-signer-dlt/internal/kwp"
+)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+type cryptoKey struct {
+	pb       *kmspb.CryptoKey
+	versions []*keyVersion
+}
+
+type importJob struct {
+	pb  *kmspb.ImportJob
+	key *rsa.PrivateKey
+}
+
+type keyVersion struct {
+	pb  *kmspb.CryptoKeyVersion
+	key *ecdsa.PrivateKey
+}
+
+// Server is a fake KeyManagementService listening on a local TCP port.
+type Server struct {
+	kmspb.UnimplementedKeyManagementServiceServer
+
+	// Addr is the address the server listens on.
+	Addr string
+
+	srv *grpc.Server
+	lis net.Listener
+
+	mu       sync.Mutex
+	keyRings map[string]*kmspb.KeyRing // by name, created by CreateKeyRing
+	keys     map[string]*cryptoKey     // by name
+	jobs     map[string]*importJob     // by name
+	faults   map[string][]Fault        // by method
+	calls    map[string]int            // by method
+	highS    bool                      // return secp256k1 signatures with a high S
+}
+
+// Fault describes a failure injected into a call to the server.
+type Fault struct {
+	Err     error         // (Optional) returned instead of handling the call
+	Corrupt bool          // (Optional) corrupt the response so that it fails its CRC32C check
+	Delay   time.Duration // (Optional) delay before handling the call
+}
+
+// NewServer starts a fake KMS server. It must be stopped with Close.
+func NewServer() (*Server, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	s := &Server{
+		Addr:     lis.Addr().String(),
+		lis:      lis,
+		keyRings: map[string]*kmspb.KeyRing{},
+		keys:     map[string]*cryptoKey{},
+		jobs:     map[string]*importJob{},
+		faults:   map[string][]Fault{},
+		calls:    map[string]int{},
+	}
+	s.srv = grpc.NewServer(grpc.UnaryInterceptor(s.intercept))
+	kmspb.RegisterKeyManagementServiceServer(s.srv, s)
+	go s.srv.Serve(lis) //nolint:errcheck
+	return s, nil
+}
+
+// ClientOptions returns the options needed for a KMS client to talk to the
+// fake server.
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.Addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+}
+
+// Close stops the server and drops all connections.
+func (s *Server) Close() {
+	s.srv.Stop()
+}
+
+// InjectFaults queues faults for the next calls of method, e.g.
+// "AsymmetricSign". Each fault applies to one call.
+func (s *Server) InjectFaults(method string, faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[method] = append(s.faults[method], faults...)
+}
+
+// SetHighS makes AsymmetricSign return secp256k1 signatures with the high S
+// value N-S, as Cloud KMS does for about half of the signatures. By default
+// the fake only returns low S values.
+func (s *Server) SetHighS(highS bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.highS = highS
+}
+
+// Calls returns how many times method has been called.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func (s *Server) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+	s.mu.Lock()
+	s.calls[method]++
+	var fault Fault
+	if faults := s.faults[method]; len(faults) > 0 {
+		fault, s.faults[method] = faults[0], faults[1:]
+	}
+	s.mu.Unlock()
+
+	if fault.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(fault.Delay):
+		}
+	}
+	if fault.Err != nil {
+		return nil, fault.Err
+	}
+	resp, err := handler(ctx, req)
+	if err != nil || !fault.Corrupt {
+		return resp, err
+	}
+	switch resp := resp.(type) {
+	case *kmspb.AsymmetricSignResponse:
+		resp.Signature = append([]byte{}, resp.Signature...)
+		resp.Signature[len(resp.Signature)-1] ^= 0xff
+	case *kmspb.PublicKey:
+		resp.PemCrc32C = wrapperspb.Int64(resp.PemCrc32C.GetValue() + 1)
+	}
+	return resp, nil
+}
+
+// CreateKey adds an ASYMMETRIC_SIGN crypto key named keyName with the given
+// labels. Keys are also created implicitly when adding versions to them.
+func (s *Server) CreateKey(keyName string, labels map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cryptoKey(keyName).pb.Labels = labels
+}
+
+// cryptoKey returns the key keyName, creating it if needed. It must be called
+// with s.mu held.
+func (s *Server) cryptoKey(keyName string) *cryptoKey {
+	key, ok := s.keys[keyName]
+	if !ok {
+		key = &cryptoKey{
+			pb: &kmspb.CryptoKey{
+				Name:    keyName,
+				Purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN,
+				VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+					Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256,
+				},
+			},
+		}
+		s.keys[keyName] = key
+	}
+	return key
+}
+
+// CreateVersion adds a new ENABLED version with a freshly generated key to the
+// crypto key keyName, and returns its name. The algorithm of the version is
+// the one of the key, EC_SIGN_SECP256K1_SHA256 unless created by
+// CreateP256Key or CreateCryptoKey.
+func (s *Server) CreateVersion(keyName string) (string, error) {
+	s.mu.Lock()
+	algorithm := s.cryptoKey(keyName).pb.VersionTemplate.Algorithm
+	s.mu.Unlock()
+	key, err := generateKey(algorithm)
+	if err != nil {
+		return "", err
+	}
+	return s.ImportVersion(keyName, key), nil
+}
+
+// CreateP256Key adds an ASYMMETRIC_SIGN crypto key named keyName whose
+// versions use the EC_SIGN_P256_SHA256 algorithm.
+func (s *Server) CreateP256Key(keyName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cryptoKey(keyName).pb.VersionTemplate.Algorithm = kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256
+}
+
+// generateKey generates a key for a version with algorithm.
+func generateKey(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) (*ecdsa.PrivateKey, error) {
+	if algorithm == kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256 {
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	return crypto.GenerateKey()
+}
+
+// ImportVersion adds a new ENABLED version backed by key to the crypto key
+// keyName, and returns its name. Its algorithm is EC_SIGN_P256_SHA256 for
+// P-256 keys and EC_SIGN_SECP256K1_SHA256 otherwise.
+func (s *Server) ImportVersion(keyName string, key *ecdsa.PrivateKey) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addVersion(s.cryptoKey(keyName), key).Name
+}
+
+// addVersion must be called with s.mu held.
+func (s *Server) addVersion(ck *cryptoKey, key *ecdsa.PrivateKey) *kmspb.CryptoKeyVersion {
+	algorithm := kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256
+	if key.Curve == elliptic.P256() {
+		algorithm = kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256
+	}
+	v := &keyVersion{
+		pb: &kmspb.CryptoKeyVersion{
+			Name:            fmt.Sprintf("%s/cryptoKeyVersions/%d", ck.pb.Name, len(ck.versions)+1),
+			State:           kmspb.CryptoKeyVersion_ENABLED,
+			Algorithm:       algorithm,
+			ProtectionLevel: ck.pb.GetVersionTemplate().GetProtectionLevel(),
+		},
+		key: key,
+	}
+	ck.versions = append(ck.versions, v)
+	return v.pb
+}
+
+// SetState changes the state of the version name.
+func (s *Server) SetState(name string, state kmspb.CryptoKeyVersion_CryptoKeyVersionState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.lookup(name)
+	if err != nil {
+		return err
+	}
+	v.pb.State = state
+	return nil
+}
+
+// PrivateKey returns the key backing the version name.
+func (s *Server) PrivateKey(name string) (*ecdsa.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return v.key, nil
+}
+
+// Versions returns the names of all versions of keyName, oldest first.
+func (s *Server) Versions(keyName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	if key, ok := s.keys[keyName]; ok {
+		for _, v := range key.versions {
+			names = append(names, v.pb.Name)
+		}
+	}
+	return names
+}
+
+// lookup must be called with s.mu held.
+func (s *Server) lookup(name string) (*keyVersion, error) {
+	i := strings.LastIndex(name, "/cryptoKeyVersions/")
+	if i < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid key version name %q", name)
+	}
+	if key, ok := s.keys[name[:i]]; ok {
+		for _, v := range key.versions {
+			if v.pb.Name == name {
+				return v, nil
+			}
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "key version %q not found", name)
+}
+
+func (s *Server) ListCryptoKeys(ctx context.Context, req *kmspb.ListCryptoKeysRequest) (*kmspb.ListCryptoKeysResponse, error) {
+	f, err := parseFilter(req.Filter, "purpose")
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &kmspb.ListCryptoKeysResponse{}
+	for name, key := range s.keys {
+		if !strings.HasPrefix(name, req.Parent+"/cryptoKeys/") {
+			continue
+		}
+		if f.match(map[string]string{"purpose": key.pb.Purpose.String()}) {
+			resp.CryptoKeys = append(resp.CryptoKeys, proto.Clone(key.pb).(*kmspb.CryptoKey))
+		}
+	}
+	sort.Slice(resp.CryptoKeys, func(i, j int) bool { return resp.CryptoKeys[i].Name < resp.CryptoKeys[j].Name })
+	resp.TotalSize = int32(len(resp.CryptoKeys))
+	return resp, nil
+}
+
+func (s *Server) ListCryptoKeyVersions(ctx context.Context, req *kmspb.ListCryptoKeyVersionsRequest) (*kmspb.ListCryptoKeyVersionsResponse, error) {
+	f, err := parseFilter(req.Filter, "state", "algorithm")
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[req.Parent]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "crypto key %q not found", req.Parent)
+	}
+	resp := &kmspb.ListCryptoKeyVersionsResponse{}
+	for _, v := range key.versions {
+		if f.match(map[string]string{"state": v.pb.State.String(), "algorithm": v.pb.Algorithm.String()}) {
+			resp.CryptoKeyVersions = append(resp.CryptoKeyVersions, proto.Clone(v.pb).(*kmspb.CryptoKeyVersion))
+		}
+	}
+	resp.TotalSize = int32(len(resp.CryptoKeyVersions))
+	return resp, nil
+}
+
+func (s *Server) GetCryptoKeyVersion(ctx context.Context, req *kmspb.GetCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.lookup(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(v.pb).(*kmspb.CryptoKeyVersion), nil
+}
+
+// GetKeyRing finds key rings created by CreateKeyRing as well as the ones
+// implied by the keys of the server.
+func (s *Server) GetKeyRing(ctx context.Context, req *kmspb.GetKeyRingRequest) (*kmspb.KeyRing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ring, ok := s.keyRings[req.Name]; ok {
+		return proto.Clone(ring).(*kmspb.KeyRing), nil
+	}
+	for name := range s.keys {
+		if strings.HasPrefix(name, req.Name+"/cryptoKeys/") {
+			return &kmspb.KeyRing{Name: req.Name}, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "key ring %q not found", req.Name)
+}
+
+func (s *Server) CreateKeyRing(ctx context.Context, req *kmspb.CreateKeyRingRequest) (*kmspb.KeyRing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := req.Parent + "/keyRings/" + req.KeyRingId
+	if _, ok := s.keyRings[name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "key ring %q already exists", name)
+	}
+	ring := &kmspb.KeyRing{Name: name}
+	s.keyRings[name] = ring
+	return proto.Clone(ring).(*kmspb.KeyRing), nil
+}
+
+// CreateCryptoKey supports ASYMMETRIC_SIGN keys with the
+// EC_SIGN_SECP256K1_SHA256 and EC_SIGN_P256_SHA256 algorithms.
+func (s *Server) CreateCryptoKey(ctx context.Context, req *kmspb.CreateCryptoKeyRequest) (*kmspb.CryptoKey, error) {
+	ck := req.GetCryptoKey()
+	algorithm := ck.GetVersionTemplate().GetAlgorithm()
+	if ck.GetPurpose() != kmspb.CryptoKey_ASYMMETRIC_SIGN || (algorithm != kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256 && algorithm != kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256) {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported purpose %s or algorithm %s", ck.GetPurpose(), algorithm)
+	}
+	var key *ecdsa.PrivateKey
+	if !req.SkipInitialVersionCreation {
+		var err error
+		if key, err = generateKey(algorithm); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := req.Parent + "/cryptoKeys/" + req.CryptoKeyId
+	if _, ok := s.keys[name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "crypto key %q already exists", name)
+	}
+	pb := proto.Clone(ck).(*kmspb.CryptoKey)
+	pb.Name = name
+	created := &cryptoKey{pb: pb}
+	s.keys[name] = created
+	if key != nil {
+		s.addVersion(created, key)
+	}
+	return proto.Clone(pb).(*kmspb.CryptoKey), nil
+}
+
+func (s *Server) GetCryptoKey(ctx context.Context, req *kmspb.GetCryptoKeyRequest) (*kmspb.CryptoKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[req.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "crypto key %q not found", req.Name)
+	}
+	return proto.Clone(key.pb).(*kmspb.CryptoKey), nil
+}
+
+// UpdateCryptoKey supports updating the labels of a key.
+func (s *Server) UpdateCryptoKey(ctx context.Context, req *kmspb.UpdateCryptoKeyRequest) (*kmspb.CryptoKey, error) {
+	for _, path := range req.GetUpdateMask().GetPaths() {
+		if path != "labels" {
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported update mask path %q", path)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[req.GetCryptoKey().GetName()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "crypto key %q not found", req.GetCryptoKey().GetName())
+	}
+	labels := map[string]string{}
+	for k, v := range req.CryptoKey.Labels {
+		labels[k] = v
+	}
+	key.pb.Labels = labels
+	return proto.Clone(key.pb).(*kmspb.CryptoKey), nil
+}
+
+// CreateCryptoKeyVersion adds a version with a freshly generated key to an
+// existing crypto key.
+func (s *Server) CreateCryptoKeyVersion(ctx context.Context, req *kmspb.CreateCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	s.mu.Lock()
+	_, ok := s.keys[req.Parent]
+	s.mu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "crypto key %q not found", req.Parent)
+	}
+	name, err := s.CreateVersion(req.Parent)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return s.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: name})
+}
+
+// UpdateCryptoKeyVersion supports enabling and disabling a version.
+func (s *Server) UpdateCryptoKeyVersion(ctx context.Context, req *kmspb.UpdateCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	for _, path := range req.GetUpdateMask().GetPaths() {
+		if path != "state" {
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported update mask path %q", path)
+		}
+	}
+	state := req.GetCryptoKeyVersion().GetState()
+	if state != kmspb.CryptoKeyVersion_ENABLED && state != kmspb.CryptoKeyVersion_DISABLED {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot set state %s", state)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.lookup(req.GetCryptoKeyVersion().GetName())
+	if err != nil {
+		return nil, err
+	}
+	v.pb.State = state
+	return proto.Clone(v.pb).(*kmspb.CryptoKeyVersion), nil
+}
+
+// importMethodRSAOAEP3072SHA256AES256 is the only import method supported.
+const importMethodRSAOAEP3072SHA256AES256 kmspb.ImportJob_ImportMethod = 3
+
+func (s *Server) CreateImportJob(ctx context.Context, req *kmspb.CreateImportJobRequest) (*kmspb.ImportJob, error) {
+	if req.GetImportJob().GetImportMethod() != importMethodRSAOAEP3072SHA256AES256 {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported import method %s", req.GetImportJob().GetImportMethod())
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 3072)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := req.Parent + "/importJobs/" + req.ImportJobId
+	if _, ok := s.jobs[name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "import job %q already exists", name)
+	}
+	pb := proto.Clone(req.ImportJob).(*kmspb.ImportJob)
+	pb.Name = name
+	pb.State = kmspb.ImportJob_ACTIVE
+	pb.PublicKey = &kmspb.ImportJob_WrappingPublicKey{
+		Pem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}
+	s.jobs[name] = &importJob{pb: pb, key: key}
+	return proto.Clone(pb).(*kmspb.ImportJob), nil
+}
+
+func (s *Server) GetImportJob(ctx context.Context, req *kmspb.GetImportJobRequest) (*kmspb.ImportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[req.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "import job %q not found", req.Name)
+	}
+	return proto.Clone(job.pb).(*kmspb.ImportJob), nil
+}
+
+// ImportCryptoKeyVersion unwraps the PKCS #8 encoded secp256k1 key and adds
+// it as a new version of the parent key.
+func (s *Server) ImportCryptoKeyVersion(ctx context.Context, req *kmspb.ImportCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	if req.Algorithm != kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256 {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported algorithm %s", req.Algorithm)
+	}
+	s.mu.Lock()
+	job, jobOK := s.jobs[req.ImportJob]
+	ck, keyOK := s.keys[req.Parent]
+	s.mu.Unlock()
+	if !jobOK {
+		return nil, status.Errorf(codes.NotFound, "import job %q not found", req.ImportJob)
+	}
+	if !keyOK {
+		return nil, status.Errorf(codes.NotFound, "crypto key %q not found", req.Parent)
+	}
+	if job.pb.ProtectionLevel != ck.pb.GetVersionTemplate().GetProtectionLevel() {
+		return nil, status.Error(codes.FailedPrecondition, "protection levels of import job and key differ")
+	}
+	wrapped := req.GetRsaAesWrappedKey()
+	size := job.key.Size()
+	if len(wrapped) <= size {
+		return nil, status.Error(codes.InvalidArgument, "wrapped key material too short")
+	}
+	aesKey, err := rsa.DecryptOAEP(sha256.New(), nil, job.key, wrapped[:size], nil)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "failed to unwrap the ephemeral key")
+	}
+	material, err := kwp.Unwrap(aesKey, wrapped[size:])
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "failed to unwrap the key material")
+	}
+	key, err := parsePKCS8(material)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return proto.Clone(s.addVersion(ck, key)).(*kmspb.CryptoKeyVersion), nil
+}
+
+// parsePKCS8 parses a PKCS #8 encoded secp256k1 private key.
+func parsePKCS8(der []byte) (*ecdsa.PrivateKey, error) {
+	var outer struct {
+		Version    int
+		Algo       pkix.AlgorithmIdentifier
+		PrivateKey []byte
+	}
+	if rest, err := asn1.Unmarshal(der, &outer); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("invalid PKCS #8 key")
+	}
+	var curve asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(outer.Algo.Parameters.FullBytes, &curve); err != nil || !outer.Algo.Algorithm.Equal(oidPublicKeyECDSA) || !curve.Equal(oidSecp256k1) {
+		return nil, fmt.Errorf("not a secp256k1 key")
+	}
+	var inner struct {
+		Version       int
+		PrivateKey    []byte
+		NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+		PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+	}
+	if _, err := asn1.Unmarshal(outer.PrivateKey, &inner); err != nil {
+		return nil, fmt.Errorf("invalid EC private key")
+	}
+	return crypto.ToECDSA(inner.PrivateKey)
+}
+
+func (s *Server) GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest) (*kmspb.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.lookup(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if v.pb.State != kmspb.CryptoKeyVersion_ENABLED {
+		return nil, status.Errorf(codes.FailedPrecondition, "key version %q is not enabled", req.Name)
+	}
+	pemString, err := marshalPublicKey(&v.key.PublicKey)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &kmspb.PublicKey{
+		Name:      v.pb.Name,
+		Pem:       pemString,
+		PemCrc32C: wrapperspb.Int64(int64(crc32c([]byte(pemString)))),
+		Algorithm: v.pb.Algorithm,
+	}, nil
+}
+
+func (s *Server) AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest) (*kmspb.AsymmetricSignResponse, error) {
+	digest := req.GetDigest().GetSha256()
+	if len(digest) != 32 {
+		return nil, status.Error(codes.InvalidArgument, "a 32 byte sha256 digest is required")
+	}
+	if req.DigestCrc32C != nil && int64(crc32c(digest)) != req.DigestCrc32C.Value {
+		return nil, status.Error(codes.InvalidArgument, "digest_crc32c mismatch")
+	}
+	s.mu.Lock()
+	v, err := s.lookup(req.Name)
+	if err == nil && v.pb.State != kmspb.CryptoKeyVersion_ENABLED {
+		err = status.Errorf(codes.FailedPrecondition, "key version %q is not enabled", req.Name)
+	}
+	highS := s.highS
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := sign(v.key, digest, highS)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &kmspb.AsymmetricSignResponse{
+		Name:                 v.pb.Name,
+		Signature:            der,
+		SignatureCrc32C:      wrapperspb.Int64(int64(crc32c(der))),
+		VerifiedDigestCrc32C: req.DigestCrc32C != nil,
+	}, nil
+}
+
+type filterTerm struct {
+	field, value string
+}
+
+// filter is a conjunction of equality terms, e.g.
+// "state=ENABLED AND algorithm=EC_SIGN_SECP256K1_SHA256".
+type filter []filterTerm
+
+func parseFilter(f string, fields ...string) (filter, error) {
+	var terms filter
+	if strings.TrimSpace(f) == "" {
+		return terms, nil
+	}
+	for _, term := range strings.Split(f, " AND ") {
+		field, value, ok := strings.Cut(strings.TrimSpace(term), "=")
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported filter term %q", term)
+		}
+		supported := false
+		for _, name := range fields {
+			supported = supported || name == field
+		}
+		if !supported {
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported filter field %q", field)
+		}
+		terms = append(terms, filterTerm{field: field, value: value})
+	}
+	return terms, nil
+}
+
+func (f filter) match(values map[string]string) bool {
+	for _, term := range f {
+		if values[term.field] != term.value {
+			return false
+		}
+	}
+	return true
+}
+
+// sign returns the DER signature of digest made by key, with the high S twin
+// of secp256k1 signatures if highS is set.
+func sign(key *ecdsa.PrivateKey, digest []byte, highS bool) ([]byte, error) {
+	if key.Curve == elliptic.P256() {
+		return ecdsa.SignASN1(rand.Reader, key, digest)
+	}
+	sig, err := crypto.Sign(digest, key)
+	if err != nil {
+		return nil, err
+	}
+	sv := new(big.Int).SetBytes(sig[32:64])
+	if highS {
+		sv.Sub(crypto.S256().Params().N, sv)
+	}
+	return marshalSignature(new(big.Int).SetBytes(sig[:32]), sv)
+}
+
+func marshalPublicKey(pub *ecdsa.PublicKey) (string, error) {
+	if pub.Curve == elliptic.P256() {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", err
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+	}
+	params, err := asn1.Marshal(oidSecp256k1)
+	if err != nil {
+		return "", err
+	}
+	der, err := asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PublicKey: asn1.BitString{Bytes: elliptic.Marshal(pub.Curve, pub.X, pub.Y)},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+func marshalSignature(r, s *big.Int) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(r)
+		b.AddASN1BigInt(s)
+	})
+	return b.Bytes()
+}
+
+func crc32c(data []byte) uint32 {
+	return crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+}
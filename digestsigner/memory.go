@@ -0,0 +1,119 @@
+package digestsigner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MemorySigner is a DigestSigner backed by secp256k1 keys held in memory. It
+// is meant for tests and local development, never for production keys.
+type MemorySigner struct {
+	mu     sync.RWMutex
+	keys   map[common.Address]*ecdsa.PrivateKey
+	order  []common.Address // in the order the keys were given
+	closed bool
+}
+
+// NewMemorySigner creates a signer holding the given keys. If no key is given
+// a fresh one is generated.
+func NewMemorySigner(keys ...*ecdsa.PrivateKey) (*MemorySigner, error) {
+	if len(keys) == 0 {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	s := &MemorySigner{keys: map[common.Address]*ecdsa.PrivateKey{}}
+	for _, key := range keys {
+		if key.Curve != crypto.S256() {
+			return nil, errors.New("not a secp256k1 private key")
+		}
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		if _, ok := s.keys[addr]; !ok {
+			s.order = append(s.order, addr)
+		}
+		s.keys[addr] = key
+	}
+	return s, nil
+}
+
+func (m *MemorySigner) HasAddress(addr common.Address) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.keys[addr]
+	return ok
+}
+
+func (m *MemorySigner) ResourcePath() string {
+	return "memory"
+}
+
+func (m *MemorySigner) Status() (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return "", errors.New("signer closed")
+	}
+	return "READY", nil
+}
+
+func (m *MemorySigner) GetAddresses() []common.Address {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]common.Address{}, m.order...)
+}
+
+func (m *MemorySigner) ListVersionedKeys() map[common.Address]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := map[common.Address]string{}
+	for k := range m.keys {
+		result[k] = "memory/" + k.Hex()
+	}
+	return result
+}
+
+func (m *MemorySigner) KeyVersion(addr common.Address) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.keys[addr]; !ok {
+		return "", false
+	}
+	return "memory/" + addr.Hex(), true
+}
+
+func (m *MemorySigner) SignDigest(ctx context.Context, address common.Address, digest []byte) ([]byte, error) {
+	m.mu.RLock()
+	key, ok := m.keys[address]
+	closed := m.closed
+	m.mu.RUnlock()
+	if closed {
+		return nil, errors.New("signer closed")
+	}
+	if !ok {
+		return nil, fmt.Errorf("no eth private key found for address %s", address)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sig, err := crypto.Sign(digest, key)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+func (m *MemorySigner) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
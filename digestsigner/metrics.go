@@ -0,0 +1,145 @@
+package digestsigner
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics records the activity of one or more KMSSigners. It implements
+// prometheus.Collector and is meant to be registered with a
+// prometheus.Registerer.
+type Metrics struct {
+	signDuration     *prometheus.HistogramVec
+	signTotal        *prometheus.CounterVec
+	crcFailures      *prometheus.CounterVec
+	recoveryFailures *prometheus.CounterVec
+	discovery        prometheus.Histogram
+	loadedAddresses  *prometheus.GaugeVec
+}
+
+var _ prometheus.Collector = (*Metrics)(nil)
+
+// NewMetrics creates the signing metrics, with names prefixed by namespace.
+func NewMetrics(namespace string) *Metrics {
+	const subsystem = "kms_signer"
+	return &Metrics{
+		signDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "sign_duration_seconds",
+			Help:      "Duration of SignDigest calls, including rate limiting and retries.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+		}, []string{"address", "key_version", "code"}),
+		signTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "sign_total",
+			Help:      "SignDigest calls by gRPC code of the outcome.",
+		}, []string{"address", "key_version", "code"}),
+		crcFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "crc32c_failures_total",
+			Help:      "KMS calls failing their CRC32C integrity checks.",
+		}, []string{"method", "key_version"}),
+		recoveryFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "v_recovery_failures_total",
+			Help:      "Signatures whose recovery id could not be determined.",
+		}, []string{"address", "key_version"}),
+		discovery: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "key_discovery_duration_seconds",
+			Help:      "Duration of listing key versions and fetching their public keys.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+		}),
+		loadedAddresses: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "loaded_addresses",
+			Help:      "Number of addresses a signer can currently sign for.",
+		}, []string{"resource"}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.signDuration, m.signTotal, m.crcFailures, m.recoveryFailures, m.discovery, m.loadedAddresses}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+func (m *Metrics) observeSign(address common.Address, keyVersion string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	code := ErrorCode(err).String()
+	m.signDuration.WithLabelValues(address.Hex(), keyVersion, code).Observe(time.Since(start).Seconds())
+	m.signTotal.WithLabelValues(address.Hex(), keyVersion, code).Inc()
+}
+
+func (m *Metrics) observeCRCFailure(method, keyVersion string) {
+	if m == nil {
+		return
+	}
+	m.crcFailures.WithLabelValues(method, keyVersion).Inc()
+}
+
+func (m *Metrics) observeRecoveryFailure(address common.Address, keyVersion string) {
+	if m == nil {
+		return
+	}
+	m.recoveryFailures.WithLabelValues(address.Hex(), keyVersion).Inc()
+}
+
+func (m *Metrics) observeDiscovery(start time.Time) {
+	if m == nil {
+		return
+	}
+	m.discovery.Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) setLoadedAddresses(resource string, n int) {
+	if m == nil {
+		return
+	}
+	m.loadedAddresses.WithLabelValues(resource).Set(float64(n))
+}
+
+// ErrorCode maps err to the gRPC code best describing it, including the
+// errors raised by the signer itself. It is the value of the outcome label
+// of metrics and of AttrOutcome.
+func ErrorCode(err error) codes.Code {
+	switch {
+	case err == nil:
+		return codes.OK
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Code()
+	case errors.Is(err, ErrCorrupted):
+		return codes.DataLoss
+	case errors.Is(err, ErrRateLimited):
+		return codes.ResourceExhausted
+	case errors.Is(err, ErrCircuitOpen):
+		return codes.Unavailable
+	}
+	return grpcCode(err)
+}
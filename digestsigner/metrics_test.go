@@ -0,0 +1,56 @@
+package digestsigner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner/kmstest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics("test")
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	cred, srv := newTestCred(t, 2)
+	cred.Retry = &RetryPolicy{}
+	cred.Metrics = metrics
+	signer := newTestSigner(t, cred)
+	address := signer.GetAddresses()[0]
+	keyVersion := signer.ListVersionedKeys()[address]
+	digest := crypto.Keccak256([]byte("test"))
+
+	srv.InjectFaults("AsymmetricSign",
+		kmstest.Fault{Err: status.Error(codes.Unavailable, "degraded")},
+		kmstest.Fault{Corrupt: true},
+	)
+	for i := 0; i < 3; i++ {
+		signer.SignDigest(context.Background(), address, digest)
+	}
+
+	for code, want := range map[codes.Code]float64{codes.OK: 1, codes.Unavailable: 1, codes.DataLoss: 1} {
+		got := testutil.ToFloat64(metrics.signTotal.WithLabelValues(address.Hex(), keyVersion, code.String()))
+		if got != want {
+			t.Errorf("sign_total{code=%q}: have %v, want %v", code, got, want)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.crcFailures.WithLabelValues("AsymmetricSign", keyVersion)); got != 1 {
+		t.Errorf("crc32c_failures_total: have %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.loadedAddresses.WithLabelValues(signer.ResourcePath())); got != 2 {
+		t.Errorf("loaded_addresses: have %v, want 2", got)
+	}
+	if n := testutil.CollectAndCount(metrics, "test_kms_signer_key_discovery_duration_seconds"); n != 1 {
+		t.Errorf("expected discovery duration to be recorded, got %d series", n)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,302 @@
+package digestsigner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// Rotation describes a key rotated by Rotate.
+type Rotation struct {
+	Version  string         // name of the new primary version
+	Address  common.Address // address of the new primary version, zero for P-256 keys
+	Retired  []string       // versions disabled once the grace period is over
+	RetireAt time.Time
+}
+
+// PrimaryAddress returns the address of the primary version of the first
+// key, in the order of GetAddresses.
+func (k *KMSSigner) PrimaryAddress() common.Address {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.addresses) == 0 {
+		return common.Address{}
+	}
+	return k.addresses[0]
+}
+
+// primaryVersion returns the id of the primary version of keyName: the one
+// named by the KMSCred.PrimaryLabel label of the key, the one set by Rotate,
+// KMSCred.PrimaryVersion, or "" for the latest version.
+func (k *KMSSigner) primaryVersion(keyName string, labels map[string]string) string {
+	if k.cfg.PrimaryLabel != "" {
+		if id, ok := labels[k.cfg.PrimaryLabel]; ok {
+			return id
+		}
+	}
+	k.mu.RLock()
+	id, ok := k.primaryOverride[keyName]
+	k.mu.RUnlock()
+	if ok {
+		return id
+	}
+	if k.cfg.Key != "" && keyName == k.cfg.keyname() {
+		return k.cfg.PrimaryVersion
+	}
+	return ""
+}
+
+// markPrimary returns copies of the versions of a single key, with the one
+// with id primaryID marked as primary. The latest version is primary if
+// primaryID is empty or not among the versions.
+func markPrimary(versions []*publicKey, primaryID string) []*publicKey {
+	primary := -1
+	for i, v := range versions {
+		if primaryID != "" && versionID(v.name) == primaryID {
+			primary = i
+			break
+		}
+		if primary < 0 || versionLess(versions[primary].name, v.name) {
+			primary = i
+		}
+	}
+	if primaryID != "" && primary >= 0 && versionID(versions[primary].name) != primaryID {
+		log.Warn("Primary key version is not enabled, using the latest", "version", primaryID, "latest", versions[primary].name)
+	}
+	result := make([]*publicKey, len(versions))
+	for i, v := range versions {
+		c := *v
+		c.primary = i == primary
+		result[i] = &c
+	}
+	return result
+}
+
+// markCachedPrimary applies KMSCred.PrimaryVersion to keys loaded from the
+// cache, in case it changed since they were cached. The labels of the keys
+// are only known to KMS, so with KMSCred.PrimaryLabel the cached primary
+// versions are kept until revalidation.
+func (k *KMSSigner) markCachedPrimary(keys []*publicKey) []*publicKey {
+	if k.cfg.PrimaryLabel != "" || k.cfg.Key == "" || k.cfg.PrimaryVersion == "" {
+		return keys
+	}
+	var result, versions []*publicKey
+	for _, key := range keys {
+		if versionKey(key.name) == k.cfg.keyname() {
+			versions = append(versions, key)
+		} else {
+			result = append(result, key)
+		}
+	}
+	if len(versions) == 0 {
+		return keys
+	}
+	return append(result, markPrimary(versions, k.primaryVersion(k.cfg.keyname(), nil))...)
+}
+
+// orderKeys sorts keys by key name, the primary version of every key first
+// and the others from latest to oldest. Keys without a primary version get
+// their latest version as primary.
+func orderKeys(keys []*publicKey) []*publicKey {
+	byKey := map[string][]*publicKey{}
+	var names []string
+	for _, key := range keys {
+		name := versionKey(key.name)
+		if _, ok := byKey[name]; !ok {
+			names = append(names, name)
+		}
+		byKey[name] = append(byKey[name], key)
+	}
+	sort.Strings(names)
+
+	var primaries, others []*publicKey
+	for _, name := range names {
+		versions := byKey[name]
+		hasPrimary := false
+		for _, v := range versions {
+			hasPrimary = hasPrimary || v.primary
+		}
+		if !hasPrimary {
+			versions = markPrimary(versions, "")
+		}
+		sort.Slice(versions, func(i, j int) bool { return versionLess(versions[j].name, versions[i].name) })
+		for _, v := range versions {
+			if v.primary {
+				primaries = append(primaries, v)
+			} else {
+				others = append(others, v)
+			}
+		}
+	}
+	return append(primaries, others...)
+}
+
+// versionKey returns the name of the key of a key version.
+func versionKey(version string) string {
+	if i := strings.LastIndex(version, "/cryptoKeyVersions/"); i >= 0 {
+		return version[:i]
+	}
+	return version
+}
+
+// versionID returns the id of a key version, e.g. "3".
+func versionID(version string) string {
+	return version[strings.LastIndex(version, "/")+1:]
+}
+
+// versionLess reports whether version a of a key is older than version b.
+func versionLess(a, b string) bool {
+	ia, erra := strconv.Atoi(versionID(a))
+	ib, errb := strconv.Atoi(versionID(b))
+	if erra != nil || errb != nil {
+		return versionID(a) < versionID(b)
+	}
+	return ia < ib
+}
+
+// Rotate creates a new version of keyName, or of KMSCred.Key if empty, and
+// makes it the primary version. The previous versions keep signing for the
+// grace period, after which they are disabled in KMS. If the signer is
+// closed before, they have to be disabled with RetireVersions instead.
+//
+// With KMSCred.PrimaryLabel the label of the key is updated, otherwise the
+// new version stays primary until the signer is closed.
+func (k *KMSSigner) Rotate(ctx context.Context, keyName string, grace time.Duration) (*Rotation, error) {
+	if k.cfg.KeyVersion != "" {
+		return nil, errors.New("cannot rotate a pinned key version")
+	}
+	if keyName == "" {
+		if k.cfg.Key == "" {
+			return nil, errors.New("no key to rotate given")
+		}
+		keyName = k.cfg.keyname()
+	}
+
+	version, err := k.client.CreateCryptoKeyVersion(ctx, &kmspb.CreateCryptoKeyVersionRequest{
+		Parent:           keyName,
+		CryptoKeyVersion: &kmspb.CryptoKeyVersion{},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key version: %w", err)
+	}
+	if err := waitEnabled(ctx, k.client, version); err != nil {
+		return nil, err
+	}
+
+	var retired []string
+	k.mu.RLock()
+	for name := range k.publicKeys {
+		if versionKey(name) == keyName {
+			retired = append(retired, name)
+		}
+	}
+	k.mu.RUnlock()
+	sort.Slice(retired, func(i, j int) bool { return versionLess(retired[i], retired[j]) })
+
+	if err := k.setPrimary(ctx, keyName, versionID(version.Name)); err != nil {
+		return nil, err
+	}
+	if err := k.Refresh(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load the new key version: %w", err)
+	}
+	k.mu.RLock()
+	key, ok := k.publicKeys[version.Name]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("new key version %s was not loaded", version.Name)
+	}
+
+	rotation := &Rotation{Version: version.Name, Address: key.address, Retired: retired, RetireAt: time.Now().Add(grace)}
+	if len(retired) > 0 {
+		k.wg.Add(1)
+		go func() {
+			defer k.wg.Done()
+			select {
+			case <-k.ctx.Done():
+				log.Warn("Signer closed before retiring rotated key versions", "versions", retired)
+				return
+			case <-time.After(grace):
+			}
+			ctx, cancel := context.WithTimeout(k.ctx, time.Minute)
+			defer cancel()
+			if err := k.RetireVersions(ctx, retired...); err != nil {
+				log.Error("Failed to retire rotated key versions", "versions", retired, "err", err)
+			}
+		}()
+	}
+	return rotation, nil
+}
+
+// waitEnabled polls version until it is enabled, since keys in HSMs are
+// generated and imported asynchronously.
+func waitEnabled(ctx context.Context, client *kms.KeyManagementClient, version *kmspb.CryptoKeyVersion) error {
+	for version.State != kmspb.CryptoKeyVersion_ENABLED {
+		if version.State != kmspb.CryptoKeyVersion_PENDING_GENERATION && version.State != kmspb.CryptoKeyVersion_PENDING_IMPORT {
+			return fmt.Errorf("key version %s is %s", version.Name, version.State)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("key version %s is still %s: %w", version.Name, version.State, ctx.Err())
+		case <-time.After(500 * time.Millisecond):
+		}
+		var err error
+		version, err = client.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: version.Name})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setPrimary makes the version with id the primary version of keyName.
+func (k *KMSSigner) setPrimary(ctx context.Context, keyName, id string) error {
+	if k.cfg.PrimaryLabel == "" {
+		k.mu.Lock()
+		k.primaryOverride[keyName] = id
+		k.mu.Unlock()
+		return nil
+	}
+	key, err := k.client.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: keyName})
+	if err != nil {
+		return err
+	}
+	labels := map[string]string{}
+	for name, value := range key.Labels {
+		labels[name] = value
+	}
+	labels[k.cfg.PrimaryLabel] = id
+	_, err = k.client.UpdateCryptoKey(ctx, &kmspb.UpdateCryptoKeyRequest{
+		CryptoKey:  &kmspb.CryptoKey{Name: keyName, Labels: labels},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"labels"}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to label the primary key version: %w", err)
+	}
+	return nil
+}
+
+// RetireVersions disables the given key versions in KMS and drops them from
+// the signer.
+func (k *KMSSigner) RetireVersions(ctx context.Context, versions ...string) error {
+	for _, name := range versions {
+		_, err := k.client.UpdateCryptoKeyVersion(ctx, &kmspb.UpdateCryptoKeyVersionRequest{
+			CryptoKeyVersion: &kmspb.CryptoKeyVersion{Name: name, State: kmspb.CryptoKeyVersion_DISABLED},
+			UpdateMask:       &fieldmaskpb.FieldMask{Paths: []string{"state"}},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to disable key version %s: %w", name, err)
+		}
+		log.Info("Disabled retired key version", "version", name)
+	}
+	return k.Refresh(ctx)
+}
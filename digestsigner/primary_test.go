@@ -0,0 +1,214 @@
+package digestsigner
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner/kmstest"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+func TestKMSSignerPrimary(t *testing.T) {
+	cred, srv := newTestCred(t, 11)
+	versions := srv.Versions(cred.keyname())
+	addressOf := func(signer *KMSSigner, version string) string {
+		for addr, name := range signer.ListVersionedKeys() {
+			if name == version {
+				return addr.Hex()
+			}
+		}
+		return ""
+	}
+
+	// the latest version is primary, followed by the others from latest to oldest
+	signer := newTestSigner(t, cred)
+	addresses := signer.GetAddresses()
+	for i, addr := range addresses {
+		if want := versions[len(versions)-1-i]; signer.ListVersionedKeys()[addr] != want {
+			t.Fatalf("address %d is %s, want %s", i, signer.ListVersionedKeys()[addr], want)
+		}
+	}
+	if signer.PrimaryAddress() != addresses[0] {
+		t.Fatalf("unexpected primary address %s", signer.PrimaryAddress())
+	}
+
+	cred.PrimaryVersion = "2"
+	signer = newTestSigner(t, cred)
+	if got := signer.PrimaryAddress().Hex(); got != addressOf(signer, versions[1]) {
+		t.Fatalf("configured primary version not first, got %s", got)
+	}
+
+	cred.PrimaryLabel = "primary-version"
+	srv.CreateKey(cred.keyname(), map[string]string{"primary-version": "5"})
+	signer = newTestSigner(t, cred)
+	if got := signer.PrimaryAddress().Hex(); got != addressOf(signer, versions[4]) {
+		t.Fatalf("labeled primary version not first, got %s", got)
+	}
+}
+
+func TestKMSSignerPrimaryCached(t *testing.T) {
+	for _, label := range []bool{false, true} {
+		cred, srv := newTestCred(t, 3)
+		useCache(t, cred)
+		if label {
+			cred.PrimaryLabel = "primary-version"
+			srv.CreateKey(cred.keyname(), map[string]string{"primary-version": "2"})
+		} else {
+			cred.PrimaryVersion = "2"
+		}
+		key, err := srv.PrivateKey(srv.Versions(cred.keyname())[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := crypto.PubkeyToAddress(key.PublicKey)
+		if got := newTestSigner(t, cred).PrimaryAddress(); got != want {
+			t.Fatalf("label %v: primary address %s, want %s", label, got, want)
+		}
+
+		// the primary version survives the cache while KMS is unreachable
+		srv.Close()
+		if got := newTestSigner(t, cred).PrimaryAddress(); got != want {
+			t.Fatalf("label %v: cached primary address %s, want %s", label, got, want)
+		}
+	}
+}
+
+func TestKMSSignerRotate(t *testing.T) {
+	ctx := context.Background()
+	for _, label := range []string{"", "primary-version"} {
+		cred, _ := newTestCred(t, 2)
+		cred.PrimaryVersion = "1"
+		cred.PrimaryLabel = label
+		signer := newTestSigner(t, cred)
+		old := signer.GetAddresses()
+
+		rotation, err := signer.Rotate(ctx, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rotation.Retired) != 2 || signer.PrimaryAddress() != rotation.Address {
+			t.Fatalf("unexpected rotation %+v, primary %s", rotation, signer.PrimaryAddress())
+		}
+		if _, err := signer.SignDigest(ctx, rotation.Address, crypto.Keccak256([]byte("test"))); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, func() bool { return len(signer.GetAddresses()) == 1 })
+		for _, addr := range old {
+			if signer.HasAddress(addr) {
+				t.Fatalf("retired address %s still loaded", addr)
+			}
+		}
+		for _, name := range rotation.Retired {
+			v, err := signer.client.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: name})
+			if err != nil || v.State != kmspb.CryptoKeyVersion_DISABLED {
+				t.Fatalf("retired version %s is %v, %v", name, v.GetState(), err)
+			}
+		}
+		if label != "" {
+			key, err := signer.client.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: cred.keyname()})
+			if err != nil || key.Labels[label] != "3" {
+				t.Fatalf("primary label not updated: %v, %v", key.GetLabels(), err)
+			}
+		}
+	}
+}
+
+func TestKMSSignerRotateGrace(t *testing.T) {
+	ctx := context.Background()
+	cred, _ := newTestCred(t, 1)
+	signer := newTestSigner(t, cred)
+	old := signer.PrimaryAddress()
+
+	rotation, err := signer.Rotate(ctx, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.PrimaryAddress() != rotation.Address || signer.GetAddresses()[1] != old {
+		t.Fatalf("unexpected addresses %v after rotation to %s", signer.GetAddresses(), rotation.Address)
+	}
+	if _, err := signer.SignDigest(ctx, old, crypto.Keccak256([]byte("test"))); err != nil {
+		t.Fatalf("old version stopped signing during the grace period: %v", err)
+	}
+}
+
+func TestKMSSignerRotateRefresh(t *testing.T) {
+	ctx := context.Background()
+	cred, _ := newTestCred(t, 2)
+	var (
+		mu    sync.Mutex
+		added []string
+	)
+	cred.RefreshInterval = 20 * time.Millisecond
+	cred.OnKeysChanged = func(c KeyChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, name := range c.Added {
+			added = append(added, name)
+		}
+	}
+	signer := newTestSigner(t, cred)
+
+	// a listing made before the versions are retired must not be applied
+	// after the one made by RetireVersions
+	for i := 0; i < 5; i++ {
+		rotation, err := signer.Rotate(ctx, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		added = nil // the new version is loaded by now
+		mu.Unlock()
+		waitFor(t, func() bool { return len(signer.GetAddresses()) == 1 })
+		time.Sleep(5 * cred.RefreshInterval)
+		if addresses := signer.GetAddresses(); len(addresses) != 1 || addresses[0] != rotation.Address {
+			t.Fatalf("unexpected addresses %v after rotation to %s", addresses, rotation.Address)
+		}
+		mu.Lock()
+		if len(added) > 0 {
+			t.Fatalf("retired versions %v were loaded again", added)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestKMSSignerRetireRefresh(t *testing.T) {
+	ctx := context.Background()
+	cred, srv := newTestCred(t, 1)
+	var (
+		mu      sync.Mutex
+		changes []KeyChange
+	)
+	cred.RefreshInterval = 300 * time.Millisecond
+	cred.OnKeysChanged = func(c KeyChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, c)
+	}
+	signer := newTestSigner(t, cred)
+	old := signer.GetAddresses()[0]
+
+	// the refresher lists both versions, then stalls fetching the new one
+	calls := srv.Calls("GetPublicKey")
+	srv.InjectFaults("GetPublicKey", kmstest.Fault{Delay: 150 * time.Millisecond})
+	if _, err := srv.CreateVersion(cred.keyname()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return srv.Calls("GetPublicKey") > calls })
+	if err := signer.RetireVersions(ctx, signer.ListVersionedKeys()[old]); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond) // until the stalled refresh is over
+	if signer.HasAddress(old) || len(signer.GetAddresses()) != 1 {
+		t.Fatalf("retired address %s loaded again: %v", old, signer.GetAddresses())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, c := range changes {
+		if _, ok := c.Added[old]; ok {
+			t.Fatalf("change %d added the retired address again: %+v", i, c)
+		}
+	}
+}
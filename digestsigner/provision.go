@@ -0,0 +1,211 @@
+package digestsigner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"google.golang.org/api/iterator"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// ProvisionOptions describes the key created by Provision.
+type ProvisionOptions struct {
+	ProtectionLevel kmspb.ProtectionLevel // (Optional) HSM or SOFTWARE, defaults to HSM
+	Labels          map[string]string     // (Optional) labels set on the key
+}
+
+// Provision creates the key ring and the secp256k1 signing key named by cred,
+// unless they already exist, and returns the credential of the key along with
+// the address of its latest enabled version. An existing key must match the
+// requested purpose, algorithm and protection level, and gets the requested
+// labels added. A key without enabled version gets a new one.
+func Provision(ctx context.Context, cred *KMSCred, opts ProvisionOptions) (*KMSCred, common.Address, error) {
+	if cred.ProjectID == "" || cred.Location == "" || cred.KeyRing == "" || cred.Key == "" {
+		return nil, common.Address{}, errors.New("project, location, key ring and key are required")
+	}
+	if opts.ProtectionLevel == kmspb.ProtectionLevel_PROTECTION_LEVEL_UNSPECIFIED {
+		opts.ProtectionLevel = kmspb.ProtectionLevel_HSM
+	}
+	if opts.ProtectionLevel != kmspb.ProtectionLevel_HSM && opts.ProtectionLevel != kmspb.ProtectionLevel_SOFTWARE {
+		return nil, common.Address{}, fmt.Errorf("unsupported protection level %s", opts.ProtectionLevel)
+	}
+	client, err := newKMSClient(ctx, cred)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	defer client.Close()
+
+	if err := ensureKeyRing(ctx, client, cred); err != nil {
+		return nil, common.Address{}, err
+	}
+	if err := ensureKey(ctx, client, cred, opts, false); err != nil {
+		return nil, common.Address{}, err
+	}
+	version, err := ensureVersion(ctx, client, cred.keyname())
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	address, err := versionAddress(ctx, client, version)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	result := *cred
+	result.KeyVersion = ""
+	return &result, address, nil
+}
+
+// versionAddress returns the address of the key version named version.
+func versionAddress(ctx context.Context, client *kms.KeyManagementClient, version string) (common.Address, error) {
+	resp, err := client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: version})
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to get public key: %w", err)
+	}
+	if int64(crc32c([]byte(resp.Pem))) != resp.GetPemCrc32C().GetValue() {
+		return common.Address{}, fmt.Errorf("GetPublicKey: response %w", ErrCorrupted)
+	}
+	pub, err := PemToPubkey(resp.Pem)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%s: %w", version, err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+func ensureKeyRing(ctx context.Context, client *kms.KeyManagementClient, cred *KMSCred) error {
+	ring := KeyRingRef{ProjectID: cred.ProjectID, Location: cred.Location, KeyRing: cred.KeyRing}
+	_, err := client.GetKeyRing(ctx, &kmspb.GetKeyRingRequest{Name: ring.name()})
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+	_, err = client.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{
+		Parent:    fmt.Sprintf("projects/%s/locations/%s", cred.ProjectID, cred.Location),
+		KeyRingId: cred.KeyRing,
+		KeyRing:   &kmspb.KeyRing{},
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return nil // created concurrently
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create key ring: %w", err)
+	}
+	log.Info("Created key ring", "name", ring.name())
+	return nil
+}
+
+// ensureKey creates the key of cred unless it exists. An import only key is
+// created without versions.
+func ensureKey(ctx context.Context, client *kms.KeyManagementClient, cred *KMSCred, opts ProvisionOptions, importOnly bool) error {
+	key, err := client.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: cred.keyname()})
+	if status.Code(err) == codes.NotFound {
+		ring := KeyRingRef{ProjectID: cred.ProjectID, Location: cred.Location, KeyRing: cred.KeyRing}
+		key, err = client.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+			Parent:      ring.name(),
+			CryptoKeyId: cred.Key,
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN,
+				VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+					Algorithm:       kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256,
+					ProtectionLevel: opts.ProtectionLevel,
+				},
+				Labels:     opts.Labels,
+				ImportOnly: importOnly,
+			},
+			SkipInitialVersionCreation: importOnly,
+		})
+		if status.Code(err) == codes.AlreadyExists {
+			return ensureKey(ctx, client, cred, opts, importOnly) // created concurrently
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create key: %w", err)
+		}
+		log.Info("Created key", "name", key.Name, "protection", opts.ProtectionLevel)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	template := key.GetVersionTemplate()
+	switch {
+	case key.Purpose != kmspb.CryptoKey_ASYMMETRIC_SIGN:
+		return fmt.Errorf("key %s has purpose %s", key.Name, key.Purpose)
+	case template.GetAlgorithm() != kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256:
+		return fmt.Errorf("key %s has algorithm %s", key.Name, template.GetAlgorithm())
+	case template.GetProtectionLevel() != opts.ProtectionLevel:
+		return fmt.Errorf("key %s has protection level %s instead of %s", key.Name, template.GetProtectionLevel(), opts.ProtectionLevel)
+	}
+	if hasLabels(key.Labels, opts.Labels) {
+		return nil
+	}
+	labels := map[string]string{}
+	for k, v := range key.Labels {
+		labels[k] = v
+	}
+	for k, v := range opts.Labels {
+		labels[k] = v
+	}
+	_, err = client.UpdateCryptoKey(ctx, &kmspb.UpdateCryptoKeyRequest{
+		CryptoKey:  &kmspb.CryptoKey{Name: key.Name, Labels: labels},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"labels"}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to label key: %w", err)
+	}
+	return nil
+}
+
+// ensureVersion returns the latest enabled version of keyName, waiting for
+// versions still being generated and creating one if there is none.
+func ensureVersion(ctx context.Context, client *kms.KeyManagementClient, keyName string) (string, error) {
+	for {
+		var latest string
+		pending := false
+		it := client.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{Parent: keyName})
+		for {
+			v, err := it.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			switch v.State {
+			case kmspb.CryptoKeyVersion_ENABLED:
+				if latest == "" || versionLess(latest, v.Name) {
+					latest = v.Name
+				}
+			case kmspb.CryptoKeyVersion_PENDING_GENERATION:
+				pending = true
+			}
+		}
+		if latest != "" {
+			return latest, nil
+		}
+		if !pending {
+			v, err := client.CreateCryptoKeyVersion(ctx, &kmspb.CreateCryptoKeyVersionRequest{
+				Parent:           keyName,
+				CryptoKeyVersion: &kmspb.CryptoKeyVersion{},
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to create key version: %w", err)
+			}
+			log.Info("Created key version", "name", v.Name)
+			if v.State == kmspb.CryptoKeyVersion_ENABLED {
+				return v.Name, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("no enabled version of %s: %w", keyName, ctx.Err())
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package digestsigner
+
+import (
+	"context"
+	"testing"
+
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+func TestProvision(t *testing.T) {
+	ctx := context.Background()
+	cred, srv := newTestCred(t, 0)
+	opts := ProvisionOptions{ProtectionLevel: kmspb.ProtectionLevel_SOFTWARE, Labels: map[string]string{"role": "hot-wallet"}}
+
+	provisioned, address, err := Provision(ctx, cred, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.Calls("CreateKeyRing") != 1 || srv.Calls("CreateCryptoKey") != 1 {
+		t.Fatalf("expected key ring and key to be created")
+	}
+	signer := newTestSigner(t, provisioned)
+	if !signer.HasAddress(address) {
+		t.Fatalf("provisioned address %s not loaded by the signer", address)
+	}
+
+	// provisioning again changes nothing but the labels
+	opts.Labels = map[string]string{"team": "payouts"}
+	_, again, err := Provision(ctx, cred, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != address || srv.Calls("CreateKeyRing") != 1 || srv.Calls("CreateCryptoKey") != 1 || srv.Calls("CreateCryptoKeyVersion") != 0 {
+		t.Fatalf("provisioning is not idempotent")
+	}
+	key, err := signer.client.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: cred.keyname()})
+	if err != nil || key.Labels["role"] != "hot-wallet" || key.Labels["team"] != "payouts" {
+		t.Fatalf("unexpected labels %v, %v", key.GetLabels(), err)
+	}
+	if key.VersionTemplate.ProtectionLevel != kmspb.ProtectionLevel_SOFTWARE {
+		t.Fatalf("unexpected protection level %s", key.VersionTemplate.ProtectionLevel)
+	}
+
+	if _, _, err := Provision(ctx, cred, ProvisionOptions{ProtectionLevel: kmspb.ProtectionLevel_HSM}); err == nil {
+		t.Fatal("expected a protection level mismatch to fail")
+	}
+
+	// a key without enabled version gets a new one
+	if err := srv.SetState(signer.ListVersionedKeys()[address], kmspb.CryptoKeyVersion_DISABLED); err != nil {
+		t.Fatal(err)
+	}
+	_, replaced, err := Provision(ctx, cred, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced == address || srv.Calls("CreateCryptoKeyVersion") != 1 {
+		t.Fatalf("expected a new version to be created")
+	}
+}
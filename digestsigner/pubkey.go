@@ -0,0 +1,208 @@
+package digestsigner
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/wfblockchain/gcp-kms-signer-dlt/internal/pemutil"
+)
+
+// Errors returned when parsing public keys. They are wrapped with details,
+// match them with errors.Is.
+var (
+	ErrInvalidPEM       = errors.New("invalid PEM")
+	ErrMalformedKey     = errors.New("malformed public key")
+	ErrTrailingData     = errors.New("trailing data after public key")
+	ErrNotECDSA         = errors.New("not an ECDSA public key")
+	ErrUnsupportedCurve = errors.New("unsupported curve")
+	ErrInvalidPoint     = errors.New("invalid curve point")
+)
+
+// pemPublicKey is the type of PEM blocks holding a SubjectPublicKeyInfo.
+const pemPublicKey = "PUBLIC KEY"
+
+type publicKeyInfo struct {
+	Raw       asn1.RawContent
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// pkcs1PublicKey reflects the ASN.1 structure of a PKCS #1 public key.
+type pkcs1PublicKey struct {
+	N *big.Int
+	E int
+}
+
+// PemToPubkey parses the first public key of a PEM string, as returned by
+// KMS, which must be a secp256k1 key. Use ParsePublicKey for P-256 keys.
+func PemToPubkey(pemString string) (*ecdsa.PublicKey, error) {
+	pub, err := ParsePublicKey([]byte(pemString))
+	if err != nil {
+		return nil, err
+	}
+	if !isSecp256k1(pub) {
+		return nil, fmt.Errorf("%w: not a secp256k1 public key", ErrUnsupportedCurve)
+	}
+	return pub, nil
+}
+
+// ParsePublicKey parses a secp256k1 or P-256 SubjectPublicKeyInfo, either DER
+// encoded or in PEM "PUBLIC KEY" blocks, in which case the first key is
+// returned. Points may be compressed or uncompressed. Only secp256k1 keys,
+// whose curve is crypto.S256(), have an Ethereum address.
+func ParsePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	keys, err := ParsePublicKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+// ParsePublicKeys parses all public keys of concatenated PEM
+// "PUBLIC KEY" blocks, or the single key of DER encoded data. Any block of
+// another type, or anything but whitespace before, between or after the
+// blocks, is an error.
+func ParsePublicKeys(data []byte) ([]*ecdsa.PublicKey, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		key, err := ParsePublicKeyDER(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*ecdsa.PublicKey{key}, nil
+	}
+	var keys []*ecdsa.PublicKey
+	for rest := data; ; {
+		var block *pem.Block
+		var skipped []byte
+		block, skipped, rest = pemutil.Decode(rest)
+		if block == nil {
+			if len(keys) == 0 {
+				return nil, fmt.Errorf("%w: no PEM block found", ErrInvalidPEM)
+			}
+			if len(bytes.TrimSpace(rest)) != 0 {
+				return nil, fmt.Errorf("%w: %d bytes after PEM block %d", ErrTrailingData, len(bytes.TrimSpace(rest)), len(keys))
+			}
+			return keys, nil
+		}
+		if junk := bytes.TrimSpace(skipped); len(junk) != 0 {
+			return nil, fmt.Errorf("%w: %d bytes of malformed data before PEM block %d", ErrInvalidPEM, len(junk), len(keys)+1)
+		}
+		if block.Type != pemPublicKey {
+			return nil, fmt.Errorf("%w: block %d has type %q instead of %q", ErrInvalidPEM, len(keys)+1, block.Type, pemPublicKey)
+		}
+		key, err := ParsePublicKeyDER(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("PEM block %d: %w", len(keys)+1, err)
+		}
+		keys = append(keys, key)
+	}
+}
+
+// ParsePublicKeyDER parses a DER encoded secp256k1 or P-256
+// SubjectPublicKeyInfo.
+func ParsePublicKeyDER(der []byte) (*ecdsa.PublicKey, error) {
+	var pki publicKeyInfo
+	if rest, err := asn1.Unmarshal(der, &pki); err != nil {
+		if _, err := asn1.Unmarshal(der, &pkcs1PublicKey{}); err == nil {
+			return nil, fmt.Errorf("%w: PKCS #1 RSA key", ErrNotECDSA)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrMalformedKey, err)
+	} else if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %d bytes after ASN.1 of public key", ErrTrailingData, len(rest))
+	}
+
+	if !pki.Algorithm.Algorithm.Equal(OidPublicKeyECDSA) {
+		return nil, fmt.Errorf("%w: algorithm %s", ErrNotECDSA, pki.Algorithm.Algorithm)
+	}
+	var namedCurveOID asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(pki.Algorithm.Parameters.FullBytes, &namedCurveOID); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: invalid ECDSA parameters", ErrMalformedKey)
+	}
+	if pki.PublicKey.BitLength%8 != 0 {
+		return nil, fmt.Errorf("%w: bit string is not byte aligned", ErrInvalidPoint)
+	}
+	switch {
+	case namedCurveOID.Equal(OidP256):
+		return parseP256Point(pki.PublicKey.Bytes)
+	case !namedCurveOID.Equal(OidSecp256k1):
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCurve, namedCurveOID)
+	}
+	point, err := secp256k1.ParsePubKey(pki.PublicKey.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPoint, err)
+	}
+	return &ecdsa.PublicKey{
+		Curve: crypto.S256(),
+		X:     point.X(),
+		Y:     point.Y(),
+	}, nil
+}
+
+func parseP256Point(point []byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		x, y = elliptic.UnmarshalCompressed(curve, point)
+	}
+	if x == nil {
+		return nil, fmt.Errorf("%w: not a P-256 point", ErrInvalidPoint)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// isSecp256k1 reports whether pub is a secp256k1 key, which has an Ethereum
+// address.
+func isSecp256k1(pub *ecdsa.PublicKey) bool {
+	return pub.Curve == crypto.S256()
+}
+
+// PubkeyToDER encodes a secp256k1 or P-256 public key as a DER
+// SubjectPublicKeyInfo with an uncompressed point, the encoding used by KMS.
+func PubkeyToDER(pub *ecdsa.PublicKey) ([]byte, error) {
+	if pub != nil && pub.Curve == elliptic.P256() {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPoint, err)
+		}
+		return der, nil
+	}
+	if pub == nil || !isSecp256k1(pub) {
+		return nil, fmt.Errorf("%w: not a secp256k1 or P-256 public key", ErrUnsupportedCurve)
+	}
+	if pub.X == nil || pub.Y == nil || !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, ErrInvalidPoint
+	}
+	params, err := asn1.Marshal(OidSecp256k1)
+	if err != nil {
+		return nil, err
+	}
+	point := crypto.FromECDSAPub(pub)
+	return asn1.Marshal(publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  OidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+}
+
+// PubkeyToPem encodes a public key as a PEM "PUBLIC KEY" block,
+// the inverse of ParsePublicKey.
+func PubkeyToPem(pub *ecdsa.PublicKey) (string, error) {
+	der, err := PubkeyToDER(pub)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: pemPublicKey, Bytes: der})), nil
+}
@@ -0,0 +1,183 @@
+package digestsigner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// kmsPem is a public key as returned by KMS.
+const kmsPem = `-----BEGIN PUBLIC KEY-----
+MFYwEAYHKoZIzj0CAQYFK4EEAAoDQgAEK+pIyZ5c51/TQQVfikG86gzOdzpRP4vf
+X0U93p2H9l6cw9acNdGoE9lVVPUp0/vMZ71ETrafJyWF7SwBcKg1GA==
+-----END PUBLIC KEY-----
+`
+
+// compressedDER encodes pub as a SubjectPublicKeyInfo with a compressed point.
+func compressedDER(t testing.TB, pub *ecdsa.PublicKey) []byte {
+	t.Helper()
+	params, _ := asn1.Marshal(OidSecp256k1)
+	point := crypto.CompressPubkey(pub)
+	der, err := asn1.Marshal(publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: OidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: params}},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParsePublicKey(t *testing.T) {
+	want, err := PemToPubkey(kmsPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode([]byte(kmsPem))
+
+	for name, data := range map[string][]byte{
+		"pem":        []byte(kmsPem),
+		"der":        block.Bytes,
+		"compressed": compressedDER(t, want),
+		"multiple":   []byte(kmsPem + "\n" + kmsPem),
+	} {
+		got, err := ParsePublicKey(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.Curve != crypto.S256() || got.X.Cmp(want.X) != 0 || got.Y.Cmp(want.Y) != 0 {
+			t.Fatalf("%s: key mismatch", name)
+		}
+	}
+	keys, err := ParsePublicKeys([]byte(kmsPem + kmsPem + kmsPem))
+	if err != nil || len(keys) != 3 {
+		t.Fatalf("expected 3 keys, got %d: %v", len(keys), err)
+	}
+}
+
+func TestParsePublicKeyErrors(t *testing.T) {
+	block, _ := pem.Decode([]byte(kmsPem))
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p384DER, _ := x509.MarshalPKIXPublicKey(&p384.PublicKey)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	badPoint := append([]byte(nil), block.Bytes...)
+	badPoint[len(badPoint)-1] ^= 1
+
+	for name, tt := range map[string]struct {
+		data string
+		want error
+	}{
+		"empty":         {"", ErrMalformedKey},
+		"garbage pem":   {"-----BEGIN PUBLIC KEY-----\n!!!\n", ErrInvalidPEM},
+		"wrong type":    {strings.Replace(kmsPem, "PUBLIC KEY", "CERTIFICATE", 2), ErrInvalidPEM},
+		"trailing pem":  {kmsPem + "garbage", ErrTrailingData},
+		"leading pem":   {"garbage\n" + kmsPem, ErrInvalidPEM},
+		"junk between":  {kmsPem + "garbage\n" + kmsPem, ErrInvalidPEM},
+		"bad block":     {kmsPem + strings.Replace(kmsPem, "END PUBLIC KEY", "END PRIVATE KEY", 1) + kmsPem, ErrInvalidPEM},
+		"trailing der":  {string(block.Bytes) + "\x00", ErrTrailingData},
+		"rsa":           {string(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)), ErrNotECDSA},
+		"rsa spki":      {string(mustMarshalPKIX(t, &rsaKey.PublicKey)), ErrNotECDSA},
+		"p384":          {string(p384DER), ErrUnsupportedCurve},
+		"invalid point": {string(badPoint), ErrInvalidPoint},
+	} {
+		_, err := ParsePublicKey([]byte(tt.data))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: have %v, want %v", name, err, tt.want)
+		}
+	}
+}
+
+func mustMarshalPKIX(t testing.TB, pub interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestPubkeyToPem(t *testing.T) {
+	want, err := PemToPubkey(kmsPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := PubkeyToPem(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != kmsPem {
+		t.Fatalf("have %s, want %s", got, kmsPem)
+	}
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if _, err := PubkeyToDER(&p384.PublicKey); !errors.Is(err, ErrUnsupportedCurve) {
+		t.Fatalf("expected unsupported curve, got %v", err)
+	}
+}
+
+func TestParseP256PublicKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pemString, err := PubkeyToPem(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if der := mustMarshalPKIX(t, &key.PublicKey); pemString != string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})) {
+		t.Fatal("P-256 encoding differs from crypto/x509")
+	}
+	point := elliptic.MarshalCompressed(elliptic.P256(), key.X, key.Y)
+	params, _ := asn1.Marshal(OidP256)
+	compressed, _ := asn1.Marshal(publicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: OidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: params}},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+	if _, err := PemToPubkey(pemString); !errors.Is(err, ErrUnsupportedCurve) {
+		t.Fatalf("expected PemToPubkey to reject P-256 keys, got %v", err)
+	}
+	for _, data := range [][]byte{[]byte(pemString), compressed} {
+		pub, err := ParsePublicKey(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pub.Equal(&key.PublicKey) {
+			t.Fatal("P-256 key mismatch")
+		}
+	}
+}
+
+func FuzzParsePublicKey(f *testing.F) {
+	block, _ := pem.Decode([]byte(kmsPem))
+	key, _ := PemToPubkey(kmsPem)
+	f.Add([]byte(kmsPem))
+	f.Add(block.Bytes)
+	f.Add(compressedDER(f, key))
+	f.Add([]byte(kmsPem + kmsPem))
+	f.Add([]byte("-----BEGIN PUBLIC KEY-----\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		keys, err := ParsePublicKeys(data)
+		if err != nil {
+			return
+		}
+		for _, key := range keys {
+			der, err := PubkeyToDER(key)
+			if err != nil {
+				t.Fatalf("failed to encode parsed key: %v", err)
+			}
+			again, err := ParsePublicKeyDER(der)
+			if err != nil {
+				t.Fatalf("failed to parse encoded key: %v", err)
+			}
+			if again.X.Cmp(key.X) != 0 || again.Y.Cmp(key.Y) != 0 {
+				t.Fatal("round trip changed the key")
+			}
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package digestsigner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned when a signing request would have to wait for the
+// client side rate limiter longer than allowed.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimit configures client side token buckets in front of AsymmetricSign,
+// to stay within the Cloud KMS quotas of a project. Requests are served in
+// the order they arrive.
+type RateLimit struct {
+	PerProject Limit            // shared by all keys of a project
+	PerKey     Limit            // applied to every crypto key on its own
+	Projects   map[string]Limit // (Optional) overrides PerProject by project id, e.g. for a project with a raised quota
+	Keys       map[string]Limit // (Optional) overrides PerKey by crypto key name, "projects/p/locations/l/keyRings/r/cryptoKeys/k"
+	MaxWait    time.Duration    // (Optional) fail with ErrRateLimited instead of waiting longer than this
+}
+
+// projectLimit returns the limit of the project named project, e.g.
+// "projects/p".
+func (c *RateLimit) projectLimit(project string) Limit {
+	if limit, ok := c.Projects[strings.TrimPrefix(project, "projects/")]; ok {
+		return limit
+	}
+	return c.PerProject
+}
+
+// keyLimit returns the limit of the crypto key named key.
+func (c *RateLimit) keyLimit(key string) Limit {
+	if limit, ok := c.Keys[key]; ok {
+		return limit
+	}
+	return c.PerKey
+}
+
+// Limit is a token bucket refilled with Rate tokens per second and holding at
+// most Burst tokens. A zero Rate means no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+type rateLimiter struct {
+	cfg     RateLimit
+	waiting int64 // accessed atomically
+
+	mu       sync.Mutex
+	projects map[string]*rate.Limiter
+	keys     map[string]*rate.Limiter
+}
+
+func newRateLimiter(cfg *RateLimit) *rateLimiter {
+	if cfg == nil {
+		return nil
+	}
+	return &rateLimiter{
+		cfg:      *cfg,
+		projects: map[string]*rate.Limiter{},
+		keys:     map[string]*rate.Limiter{},
+	}
+}
+
+// wait blocks until a call for keyVersion is allowed by both its project and
+// key buckets. It fails fast if that takes longer than MaxWait or than the
+// deadline of ctx.
+func (l *rateLimiter) wait(ctx context.Context, keyVersion string) error {
+	if l == nil {
+		return nil
+	}
+	project, key := splitKeyVersion(keyVersion)
+	l.mu.Lock()
+	now := time.Now()
+	var reservations []*rate.Reservation
+	if pl := l.limiter(l.projects, project, l.cfg.projectLimit(project)); pl != nil {
+		reservations = append(reservations, pl.ReserveN(now, 1))
+	}
+	if kl := l.limiter(l.keys, key, l.cfg.keyLimit(key)); kl != nil {
+		reservations = append(reservations, kl.ReserveN(now, 1))
+	}
+	l.mu.Unlock()
+
+	cancel := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+	delay := time.Duration(0)
+	for _, r := range reservations {
+		if !r.OK() {
+			cancel()
+			return ErrRateLimited
+		}
+		if d := r.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+	if delay == 0 {
+		return nil
+	}
+	if l.cfg.MaxWait > 0 && delay > l.cfg.MaxWait {
+		cancel()
+		return ErrRateLimited
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		cancel()
+		return ErrRateLimited
+	}
+
+	atomic.AddInt64(&l.waiting, 1)
+	defer atomic.AddInt64(&l.waiting, -1)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// limiter returns the bucket for id, creating it if needed. It must be called
+// with l.mu held, and returns nil if limit is disabled.
+func (l *rateLimiter) limiter(limiters map[string]*rate.Limiter, id string, limit Limit) *rate.Limiter {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	rl, ok := limiters[id]
+	if !ok {
+		burst := limit.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		rl = rate.NewLimiter(rate.Limit(limit.Rate), burst)
+		limiters[id] = rl
+	}
+	return rl
+}
+
+func (l *rateLimiter) queueDepth() int {
+	if l == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&l.waiting))
+}
+
+// splitKeyVersion returns the project and crypto key names of a key version
+// name.
+func splitKeyVersion(name string) (project, key string) {
+	key = name
+	if i := strings.Index(name, "/cryptoKeyVersions/"); i >= 0 {
+		key = name[:i]
+	}
+	project = name
+	if parts := strings.SplitN(name, "/", 3); len(parts) >= 2 {
+		project = parts[0] + "/" + parts[1]
+	}
+	return project, key
+}
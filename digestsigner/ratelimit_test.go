@@ -0,0 +1,101 @@
+package digestsigner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestRateLimitFailsFast(t *testing.T) {
+	cred, _ := newTestCred(t, 1)
+	cred.RateLimit = &RateLimit{
+		PerProject: Limit{Rate: 1, Burst: 1},
+		MaxWait:    50 * time.Millisecond,
+	}
+	signer := newTestSigner(t, cred)
+	address := signer.GetAddresses()[0]
+	digest := crypto.Keccak256([]byte("test"))
+
+	if _, err := signer.SignDigest(context.Background(), address, digest); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := signer.SignDigest(context.Background(), address, digest); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Fatal("rate limited request did not fail fast")
+	}
+}
+
+func TestRateLimitOverrides(t *testing.T) {
+	cred, _ := newTestCred(t, 1)
+	cred.RateLimit = &RateLimit{
+		PerProject: Limit{Rate: 1, Burst: 1},
+		PerKey:     Limit{Rate: 1, Burst: 1},
+		Projects:   map[string]Limit{cred.ProjectID: {Rate: 1000, Burst: 10}},
+		Keys:       map[string]Limit{cred.keyname(): {}},
+		MaxWait:    50 * time.Millisecond,
+	}
+	signer := newTestSigner(t, cred)
+	address := signer.GetAddresses()[0]
+	digest := crypto.Keccak256([]byte("test"))
+
+	// the overrides lift the default limits of the project and the key
+	for i := 0; i < 5; i++ {
+		if _, err := signer.SignDigest(context.Background(), address, digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limits := &RateLimit{PerProject: Limit{Rate: 1}, Projects: map[string]Limit{"other": {Rate: 2}}, Keys: map[string]Limit{"k": {Rate: 3}}}
+	if l := limits.projectLimit("projects/other"); l.Rate != 2 {
+		t.Errorf("unexpected project override %+v", l)
+	}
+	if l := limits.projectLimit("projects/p"); l.Rate != 1 {
+		t.Errorf("unexpected default project limit %+v", l)
+	}
+	if l := limits.keyLimit("k"); l.Rate != 3 {
+		t.Errorf("unexpected key override %+v", l)
+	}
+}
+
+func TestRateLimitQueues(t *testing.T) {
+	cred, _ := newTestCred(t, 1)
+	cred.RateLimit = &RateLimit{PerKey: Limit{Rate: 20, Burst: 1}}
+	signer := newTestSigner(t, cred)
+	address := signer.GetAddresses()[0]
+	digest := crypto.Keccak256([]byte("test"))
+
+	const n = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := signer.SignDigest(context.Background(), address, digest)
+			errs <- err
+		}()
+	}
+	waitFor(t, func() bool { return signer.QueueDepth() > 0 })
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first request takes the burst, the others wait 50ms each.
+	if elapsed := time.Since(start); elapsed < (n-1)*50*time.Millisecond*9/10 {
+		t.Fatalf("requests were not rate limited, took %v", elapsed)
+	}
+	if depth := signer.QueueDepth(); depth != 0 {
+		t.Fatalf("expected empty queue, got %d", depth)
+	}
+}
@@ -0,0 +1,127 @@
+package digestsigner
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCorrupted is returned when a KMS request or response fails its CRC32C
+// integrity check.
+var ErrCorrupted = errors.New("corrupted in-transit")
+
+// RetryPolicy controls how KMSSigner retries failed AsymmetricSign and
+// GetPublicKey calls. Retries never outlive the deadline of the caller's
+// context. Once a policy is set, the retries built into the KMS client are
+// disabled, so the zero RetryPolicy turns off retries altogether.
+type RetryPolicy struct {
+	MaxAttempts     int           // attempts including the first one, values below 2 disable retries
+	InitialBackoff  time.Duration // wait before the first retry
+	MaxBackoff      time.Duration // upper bound of the wait between attempts
+	Multiplier      float64       // growth of the wait after every attempt
+	RetryableCodes  []codes.Code  // gRPC codes worth retrying
+	RetryCorruption bool          // retry calls failing with ErrCorrupted
+	OnAttempt       func(Attempt) // (Optional) called after every attempt
+}
+
+// Attempt describes a single call made under a RetryPolicy.
+type Attempt struct {
+	Method  string        // KMS method, e.g. "AsymmetricSign"
+	Name    string        // key version the call was made for
+	Attempt int           // 1 for the first attempt
+	Err     error         // nil if the attempt succeeded
+	Backoff time.Duration // wait before the next attempt, zero if there is none
+}
+
+// DefaultRetryPolicy returns a policy retrying the transient failures of Cloud
+// KMS up to 5 attempts.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:     5,
+		InitialBackoff:  100 * time.Millisecond,
+		MaxBackoff:      5 * time.Second,
+		Multiplier:      2,
+		RetryableCodes:  []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal},
+		RetryCorruption: true,
+	}
+}
+
+// do runs call until it succeeds, fails permanently, runs out of attempts, or
+// ctx expires. A nil policy makes a single attempt.
+func (p *RetryPolicy) do(ctx context.Context, method, name string, call func(context.Context) error) error {
+	backoff := time.Duration(0)
+	for attempt := 1; ; attempt++ {
+		err := call(ctx)
+		wait := time.Duration(0)
+		if err != nil && p.retryable(err) && attempt < p.MaxAttempts {
+			backoff = p.next(backoff)
+			// Equal jitter: keep half of the backoff, randomize the rest.
+			wait = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				wait = 0
+			}
+		}
+		trace.SpanFromContext(ctx).AddEvent("attempt", trace.WithAttributes(
+			AttrAttempt.Int(attempt),
+			AttrOutcome.String(ErrorCode(err).String()),
+		))
+		if p != nil && p.OnAttempt != nil {
+			p.OnAttempt(Attempt{Method: method, Name: name, Attempt: attempt, Err: err, Backoff: wait})
+		}
+		if wait == 0 {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *RetryPolicy) next(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		backoff = p.InitialBackoff
+	} else if p.Multiplier > 1 {
+		backoff = time.Duration(float64(backoff) * p.Multiplier)
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		backoff = time.Millisecond
+	}
+	return backoff
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrCorrupted) {
+		return p.RetryCorruption
+	}
+	code := grpcCode(err)
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// grpcCode returns the gRPC code of err, looking through wrapped errors.
+func grpcCode(err error) codes.Code {
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) {
+		return se.GRPCStatus().Code()
+	}
+	return status.Code(err)
+}
@@ -0,0 +1,87 @@
+package digestsigner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner/kmstest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newRetryTestSigner(t *testing.T, policy *RetryPolicy) (*KMSSigner, *kmstest.Server) {
+	t.Helper()
+	cred, srv := newTestCred(t, 1)
+	cred.Retry = policy
+	return newTestSigner(t, cred), srv
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	var attempts []Attempt
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.OnAttempt = func(a Attempt) { attempts = append(attempts, a) }
+	signer, srv := newRetryTestSigner(t, policy)
+	attempts = nil
+
+	srv.InjectFaults("AsymmetricSign",
+		kmstest.Fault{Err: status.Error(codes.Unavailable, "try again")},
+		kmstest.Fault{Corrupt: true},
+	)
+	address := signer.GetAddresses()[0]
+	digest := crypto.Keccak256([]byte("test"))
+	sig, err := signer.SignDigest(context.Background(), address, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifyDigest(address, digest, sig) {
+		t.Fatal("failed to verify signature")
+	}
+	if n := srv.Calls("AsymmetricSign"); n != 3 {
+		t.Fatalf("expected 3 calls, got %d", n)
+	}
+	if len(attempts) != 3 || attempts[2].Err != nil || !errors.Is(attempts[1].Err, ErrCorrupted) {
+		t.Fatalf("unexpected attempts %+v", attempts)
+	}
+}
+
+func TestRetryPermanentFailure(t *testing.T) {
+	signer, srv := newRetryTestSigner(t, DefaultRetryPolicy())
+	srv.InjectFaults("AsymmetricSign", kmstest.Fault{Err: status.Error(codes.PermissionDenied, "denied")})
+	_, err := signer.SignDigest(context.Background(), signer.GetAddresses()[0], crypto.Keccak256([]byte("test")))
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+	if n := srv.Calls("AsymmetricSign"); n != 1 {
+		t.Fatalf("expected 1 call, got %d", n)
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Hour
+	signer, srv := newRetryTestSigner(t, policy)
+	srv.InjectFaults("AsymmetricSign", kmstest.Fault{Err: status.Error(codes.Unavailable, "try again")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := signer.SignDigest(ctx, signer.GetAddresses()[0], crypto.Keccak256([]byte("test"))); err == nil {
+		t.Fatal("expected error")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("retry outlived the context deadline")
+	}
+}
+
+func TestCorruptionWithoutRetry(t *testing.T) {
+	signer, srv := newRetryTestSigner(t, nil)
+	srv.InjectFaults("AsymmetricSign", kmstest.Fault{Corrupt: true})
+	_, err := signer.SignDigest(context.Background(), signer.GetAddresses()[0], crypto.Keccak256([]byte("test")))
+	if !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, got %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+// Package signature parses and converts secp256k1 ECDSA signatures between
+// their DER, 64 byte compact, 65 byte R || S || V and EIP-2098 forms.
+//
+// DER signatures are parsed under the strict rules of BIP-66, and R and S
+// must be in [1, N-1] in every form. Signatures with a high S value, which
+// Ethereum and BIP-62 reject, are accepted unless Options.RequireLowS is
+// set; ToLowS converts them to their low S equivalent.
+package signature
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+var (
+	// N is the order of the secp256k1 curve.
+	N, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	halfN = new(big.Int).Rsh(N, 1)
+)
+
+// Sizes of the fixed length encodings.
+const (
+	CompactSize = 64
+	RSVSize     = 65
+	EIP2098Size = 64
+)
+
+var (
+	// ErrInvalidSignature is matched by every parsing error.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrHighS is matched by the errors of signatures rejected for their
+	// high S value.
+	ErrHighS = errors.New("high S value")
+)
+
+// Error describes why a signature failed to parse. It matches
+// ErrInvalidSignature, and ErrHighS if S was rejected for being high.
+type Error struct {
+	Format string // DER, compact, RSV or EIP-2098
+	Reason string
+	highS  bool
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s signature: %s", e.Format, e.Reason)
+}
+
+func (e *Error) Is(target error) bool {
+	return target == ErrInvalidSignature || (e.highS && target == ErrHighS)
+}
+
+// Options configures the parsers.
+type Options struct {
+	RequireLowS bool // reject signatures with S > N/2
+}
+
+// Signature is a secp256k1 ECDSA signature.
+type Signature struct {
+	R, S *big.Int
+	V    byte // recovery id, 0 or 1; not carried by the DER and compact forms
+}
+
+// ParseDER parses a DER encoded signature, enforcing BIP-66: a sequence of
+// exactly two minimally encoded, positive integers with no trailing data.
+func ParseDER(der []byte, opts Options) (*Signature, error) {
+	fail := func(reason string) (*Signature, error) {
+		return nil, &Error{Format: "DER", Reason: reason}
+	}
+	// The checks follow IsValidSignatureEncoding of BIP-66, without the
+	// sighash byte.
+	switch {
+	case len(der) < 8:
+		return fail("too short")
+	case len(der) > 72:
+		return fail("too long")
+	case der[0] != 0x30:
+		return fail("not a sequence")
+	case int(der[1]) != len(der)-2:
+		return fail("sequence length does not match the data")
+	case der[2] != 0x02:
+		return fail("R is not an integer")
+	}
+	lenR := int(der[3])
+	if lenR == 0 {
+		return fail("R is empty")
+	}
+	if 5+lenR >= len(der) {
+		return fail("R length exceeds the data")
+	}
+	lenS := int(der[5+lenR])
+	switch {
+	case lenR+lenS+6 != len(der):
+		return fail("R and S lengths do not match the sequence length")
+	case der[lenR+4] != 0x02:
+		return fail("S is not an integer")
+	case lenS == 0:
+		return fail("S is empty")
+	}
+	if reason := checkInteger(der[4 : 4+lenR]); reason != "" {
+		return fail("R " + reason)
+	}
+	if reason := checkInteger(der[6+lenR:]); reason != "" {
+		return fail("S " + reason)
+	}
+	sig := &Signature{
+		R: new(big.Int).SetBytes(der[4 : 4+lenR]),
+		S: new(big.Int).SetBytes(der[6+lenR:]),
+	}
+	return sig, sig.check("DER", opts)
+}
+
+// checkInteger returns why the content of a DER integer is not a minimally
+// encoded positive integer, if it is not.
+func checkInteger(b []byte) string {
+	if b[0]&0x80 != 0 {
+		return "is negative"
+	}
+	if len(b) > 1 && b[0] == 0 && b[1]&0x80 == 0 {
+		return "has excess padding"
+	}
+	return ""
+}
+
+// ParseCompact parses a 64 byte R || S signature.
+func ParseCompact(b []byte, opts Options) (*Signature, error) {
+	if len(b) != CompactSize {
+		return nil, &Error{Format: "compact", Reason: fmt.Sprintf("%d bytes instead of %d", len(b), CompactSize)}
+	}
+	sig := &Signature{R: new(big.Int).SetBytes(b[:32]), S: new(big.Int).SetBytes(b[32:])}
+	return sig, sig.check("compact", opts)
+}
+
+// ParseRSV parses a 65 byte R || S || V signature. V is the recovery id,
+// optionally offset by 27 as in legacy Ethereum signatures.
+func ParseRSV(b []byte, opts Options) (*Signature, error) {
+	if len(b) != RSVSize {
+		return nil, &Error{Format: "RSV", Reason: fmt.Sprintf("%d bytes instead of %d", len(b), RSVSize)}
+	}
+	v := b[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return nil, &Error{Format: "RSV", Reason: fmt.Sprintf("invalid V %d", b[64])}
+	}
+	sig := &Signature{R: new(big.Int).SetBytes(b[:32]), S: new(big.Int).SetBytes(b[32:64]), V: v}
+	return sig, sig.check("RSV", opts)
+}
+
+// ParseEIP2098 parses a 64 byte EIP-2098 signature, R || yParityAndS, where
+// the top bit of S holds the recovery id. S is always low in this form.
+func ParseEIP2098(b []byte) (*Signature, error) {
+	if len(b) != EIP2098Size {
+		return nil, &Error{Format: "EIP-2098", Reason: fmt.Sprintf("%d bytes instead of %d", len(b), EIP2098Size)}
+	}
+	s := make([]byte, 32)
+	copy(s, b[32:])
+	v := s[0] >> 7
+	s[0] &= 0x7f
+	sig := &Signature{R: new(big.Int).SetBytes(b[:32]), S: new(big.Int).SetBytes(s), V: v}
+	return sig, sig.check("EIP-2098", Options{RequireLowS: true})
+}
+
+func (sig *Signature) check(format string, opts Options) error {
+	switch {
+	case sig.R.Sign() == 0:
+		return &Error{Format: format, Reason: "R is zero"}
+	case sig.R.Cmp(N) >= 0:
+		return &Error{Format: format, Reason: "R is not below the curve order"}
+	case sig.S.Sign() == 0:
+		return &Error{Format: format, Reason: "S is zero"}
+	case sig.S.Cmp(N) >= 0:
+		return &Error{Format: format, Reason: "S is not below the curve order"}
+	case opts.RequireLowS && !sig.IsLowS():
+		return &Error{Format: format, Reason: "S is above half the curve order", highS: true}
+	}
+	return nil
+}
+
+// IsLowS reports whether S is at most N/2.
+func (sig *Signature) IsLowS() bool {
+	return sig.S.Cmp(halfN) <= 0
+}
+
+// ToLowS returns the signature with S replaced by N - S if S is high, which
+// is equally valid for the same key and digest, and flips the recovery id
+// accordingly.
+func (sig *Signature) ToLowS() *Signature {
+	if sig.IsLowS() {
+		return &Signature{R: new(big.Int).Set(sig.R), S: new(big.Int).Set(sig.S), V: sig.V}
+	}
+	return &Signature{R: new(big.Int).Set(sig.R), S: new(big.Int).Sub(N, sig.S), V: sig.V ^ 1}
+}
+
+// DER returns the DER encoding of the signature, which drops V.
+func (sig *Signature) DER() []byte {
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(sig.R)
+		b.AddASN1BigInt(sig.S)
+	})
+	return b.BytesOrPanic()
+}
+
+// Compact returns the 64 byte R || S form of the signature, which drops V.
+func (sig *Signature) Compact() []byte {
+	out := make([]byte, CompactSize)
+	sig.R.FillBytes(out[:32])
+	sig.S.FillBytes(out[32:])
+	return out
+}
+
+// RSV returns the 65 byte R || S || V form of the signature, with V the bare
+// recovery id; add 27 for legacy Ethereum signatures.
+func (sig *Signature) RSV() []byte {
+	out := make([]byte, RSVSize)
+	sig.R.FillBytes(out[:32])
+	sig.S.FillBytes(out[32:64])
+	out[64] = sig.V
+	return out
+}
+
+// EIP2098 returns the 64 byte R || yParityAndS form of the signature. It is
+// only defined for low S signatures, see ToLowS.
+func (sig *Signature) EIP2098() ([]byte, error) {
+	if !sig.IsLowS() {
+		return nil, &Error{Format: "EIP-2098", Reason: "S is above half the curve order", highS: true}
+	}
+	out := sig.Compact()
+	out[32] |= (sig.V & 1) << 7
+	return out, nil
+}
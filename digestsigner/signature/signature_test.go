@@ -0,0 +1,159 @@
+package signature
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestConversions(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 32; i++ {
+		digest := crypto.Keccak256([]byte{byte(i)})
+		rsv, err := crypto.Sign(digest, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := ParseRSV(rsv, Options{RequireLowS: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sig.RSV(), rsv) {
+			t.Fatalf("RSV round trip mismatch")
+		}
+
+		der, err := ParseDER(sig.DER(), Options{RequireLowS: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, err := ParseCompact(sig.Compact(), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(der.Compact(), rsv[:64]) || !bytes.Equal(compact.Compact(), rsv[:64]) {
+			t.Fatalf("DER or compact round trip mismatch")
+		}
+
+		eip2098, err := sig.EIP2098()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseEIP2098(eip2098)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(parsed.RSV(), rsv) {
+			t.Fatalf("EIP-2098 round trip mismatch")
+		}
+
+		// the high S twin recovers the same key once made low again
+		high := &Signature{R: sig.R, S: new(big.Int).Sub(N, sig.S), V: sig.V ^ 1}
+		if _, err := ParseDER(high.DER(), Options{RequireLowS: true}); !errors.Is(err, ErrHighS) {
+			t.Fatalf("expected high S to be rejected, got %v", err)
+		}
+		if _, err := high.EIP2098(); !errors.Is(err, ErrHighS) {
+			t.Fatalf("expected high S to be rejected, got %v", err)
+		}
+		if !bytes.Equal(high.ToLowS().RSV(), rsv) {
+			t.Fatalf("ToLowS mismatch")
+		}
+	}
+}
+
+func TestEIP2098Vectors(t *testing.T) {
+	for _, tt := range []struct {
+		r, s, yParityAndS string
+		v                 byte
+	}{
+		{
+			r:           "68a020a209d3d56c46f38cc50a33f704f4a9a10a59377f8dd762ac66910e9b90",
+			s:           "7e865ad05c4035ab5792787d4a0297a43617ae897930a6fe4d822b8faea52064",
+			yParityAndS: "7e865ad05c4035ab5792787d4a0297a43617ae897930a6fe4d822b8faea52064",
+			v:           27,
+		},
+		{
+			r:           "9328da16089fcba9bececa81663203989f2df5fe1faa6291a45381c81bd17f76",
+			s:           "139c6d6b623b42da56557e5e734a43dc83345ddfadec52cbe24d0cc64f550793",
+			yParityAndS: "939c6d6b623b42da56557e5e734a43dc83345ddfadec52cbe24d0cc64f550793",
+			v:           28,
+		},
+	} {
+		rsv, _ := hex.DecodeString(tt.r + tt.s)
+		sig, err := ParseRSV(append(rsv, tt.v), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		eip2098, err := sig.EIP2098()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := hex.EncodeToString(eip2098[32:]); have != tt.yParityAndS {
+			t.Fatalf("yParityAndS: have %s, want %s", have, tt.yParityAndS)
+		}
+	}
+}
+
+func TestParseDERStrict(t *testing.T) {
+	valid := "3006020101020101"
+	if _, err := ParseDER(mustHex(t, valid), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, tt := range map[string]struct {
+		der    string
+		reason string
+	}{
+		"too short":        {"30050201010201", "too short"},
+		"not a sequence":   {"3106020101020101", "not a sequence"},
+		"length mismatch":  {"3007020101020101", "sequence length does not match the data"},
+		"trailing data":    {"300602010102010100", "sequence length does not match the data"},
+		"R not integer":    {"3006030101020101", "R is not an integer"},
+		"R empty":          {"3006020002020101", "R is empty"},
+		"R negative":       {"3006020181020101", "R is negative"},
+		"R padded":         {"300702020001020101", "R has excess padding"},
+		"S not integer":    {"3006020101030101", "S is not an integer"},
+		"S negative":       {"3006020101020181", "S is negative"},
+		"S padded":         {"300702010102020001", "S has excess padding"},
+		"R zero":           {"3006020100020101", "R is zero"},
+		"S zero":           {"3006020101020100", "S is zero"},
+		"lengths mismatch": {"3006020201020101", "R and S lengths do not match the sequence length"},
+		"S above order": {"3026020101022100fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141",
+			"S is not below the curve order"},
+	} {
+		_, err := ParseDER(mustHex(t, tt.der), Options{})
+		var serr *Error
+		if !errors.As(err, &serr) || serr.Reason != tt.reason || !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: have %v, want %q", name, err, tt.reason)
+		}
+	}
+}
+
+func mustHex(t testing.TB, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func FuzzParseDER(f *testing.F) {
+	f.Add(mustHex(f, "3006020101020101"))
+	f.Add(mustHex(f, "3044022068a020a209d3d56c46f38cc50a33f704f4a9a10a59377f8dd762ac66910e9b9002207e865ad05c4035ab5792787d4a0297a43617ae897930a6fe4d822b8faea52064"))
+	f.Fuzz(func(t *testing.T, der []byte) {
+		sig, err := ParseDER(der, Options{})
+		if err != nil {
+			return
+		}
+		// strict DER is canonical
+		if !bytes.Equal(sig.DER(), der) {
+			t.Fatalf("re-encoding changed %x to %x", der, sig.DER())
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package digestsigner
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DigestSigner is implemented by every key backend that can produce Ethereum
+// signatures over a precomputed digest.
+type DigestSigner interface {
+	// SignDigest signs the digest with the key of address and returns the
+	// signature in the R || S || V form, with V being 27 or 28.
+	SignDigest(ctx context.Context, address common.Address, digest []byte) ([]byte, error)
+	// GetAddresses returns every address the signer holds a key for, in a
+	// stable order starting with the primary address.
+	GetAddresses() []common.Address
+	// ListVersionedKeys maps every address to the name of the key behind it.
+	ListVersionedKeys() map[common.Address]string
+	// KeyVersion returns the name of the key behind addr, if any.
+	KeyVersion(addr common.Address) (string, bool)
+	// HasAddress reports whether the signer holds a key for addr.
+	HasAddress(addr common.Address) bool
+	// ResourcePath returns the backend specific location of the keys.
+	ResourcePath() string
+	// Status returns a textual status of the backend, or an error if the
+	// backend is unusable.
+	Status() (string, error)
+	// Close releases any resources held by the signer.
+	Close() error
+}
+
+var (
+	_ DigestSigner = (*KMSSigner)(nil)
+	_ DigestSigner = (*MemorySigner)(nil)
+)
@@ -0,0 +1,44 @@
+package digestsigner
+
+import (
+	"context"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+const instrumentationName = "github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner"
+
+// Span attributes set by the signer.
+const (
+	AttrAddress    = attribute.Key("eth.address")
+	AttrKeyVersion = attribute.Key("kms.key_version")
+	AttrAttempt    = attribute.Key("kms.attempt")
+	AttrOutcome    = attribute.Key("outcome")
+)
+
+// tracingOption propagates the trace context of every KMS call into its gRPC
+// request.
+func tracingOption(tp trace.TracerProvider) option.ClientOption {
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(
+		otelgrpc.UnaryClientInterceptor(otelgrpc.WithTracerProvider(tp)),
+	))
+}
+
+func (k *KMSSigner) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return k.tracer.Start(ctx, "digestsigner."+name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records the outcome of a call on span and ends it.
+func endSpan(span trace.Span, err error) {
+	span.SetAttributes(AttrOutcome.String(ErrorCode(err).String()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,58 @@
+package digestsigner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	cred, _ := newTestCred(t, 1)
+	cred.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	signer := newTestSigner(t, cred)
+	address := signer.GetAddresses()[0]
+
+	if _, err := signer.SignDigest(context.Background(), address, crypto.Keccak256([]byte("test"))); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{"digestsigner.ListCryptoKeyVersions", "digestsigner.GetPublicKey"} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("missing discovery span %s", name)
+		}
+	}
+
+	sign, ok := spans["digestsigner.SignDigest"]
+	if !ok {
+		t.Fatal("missing SignDigest span")
+	}
+	attrs := map[string]string{}
+	for _, kv := range sign.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs[string(AttrAddress)] != address.Hex() || attrs[string(AttrKeyVersion)] == "" || attrs[string(AttrOutcome)] != "OK" {
+		t.Errorf("unexpected SignDigest attributes %v", attrs)
+	}
+
+	// The KMS RPC and the V recovery are children of SignDigest, and the gRPC
+	// call carries the trace of the AsymmetricSign span.
+	kmsCall, ok := spans["digestsigner.AsymmetricSign"]
+	if !ok || kmsCall.Parent().SpanID() != sign.SpanContext().SpanID() {
+		t.Fatal("AsymmetricSign span is not a child of SignDigest")
+	}
+	if recovery, ok := spans["digestsigner.RecoverV"]; !ok || recovery.Parent().SpanID() != sign.SpanContext().SpanID() {
+		t.Fatal("RecoverV span is not a child of SignDigest")
+	}
+	rpc, ok := spans["google.cloud.kms.v1.KeyManagementService/AsymmetricSign"]
+	if !ok || rpc.Parent().SpanID() != kmsCall.SpanContext().SpanID() {
+		t.Fatal("gRPC span is not a child of AsymmetricSign")
+	}
+}
@@ -1,104 +1,88 @@
 package digestsigner
 
 import (
+	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/x509/pkix"
 	"encoding/asn1"
-	"encoding/pem"
 	"errors"
 	"hash/crc32"
 	"math/big"
 
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/ethereum/go-ethereum/crypto"
-	"golang.org/x/crypto/cryptobyte"
-	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
-)
 
-var (
-	secp256k1N, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
-	secp256k1halfN = new(big.Int).Div(secp256k1N, big.NewInt(2))
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner/signature"
 )
 
 var (
 	OidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
 	OidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+	OidP256           = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
 )
 
-type publicKeyInfo struct {
-	Raw       asn1.RawContent
-	Algorithm pkix.AlgorithmIdentifier
-	PublicKey asn1.BitString
-}
-
-// pkcs1PublicKey reflects the ASN.1 structure of a PKCS #1 public key.
-type pkcs1PublicKey struct {
-	N *big.Int
-	E int
-}
-
 func crc32c(data []byte) uint32 {
 	t := crc32.MakeTable(crc32.Castagnoli)
 	return crc32.Checksum(data, t)
 }
 
 // recover R and S from KMS signature
-func recoverRS(signature []byte) (r *big.Int, s *big.Int, err error) {
-	r, s = &big.Int{}, &big.Int{}
-	var inner cryptobyte.String
-	input := cryptobyte.String(signature)
-	if !input.ReadASN1(&inner, cryptobyte_asn1.SEQUENCE) ||
-		!input.Empty() ||
-		!inner.ReadASN1Integer(r) ||
-		!inner.ReadASN1Integer(s) ||
-		!inner.Empty() {
-		return nil, nil, errors.New("invalid sig")
+func recoverRS(der []byte) (r *big.Int, s *big.Int, err error) {
+	sig, err := signature.ParseDER(der, signature.Options{})
+	if err != nil {
+		return nil, nil, err
 	}
 	// Google may have already encured that the signature is valid, but we
 	// can't assume that.
-	if s.Cmp(secp256k1halfN) > 0 {
-		s = s.Sub(secp256k1N, s)
-	}
-	return r, s, nil
+	sig = sig.ToLowS()
+	return sig.R, sig.S, nil
 }
 
-func PemToPubkey(pemString string) (*ecdsa.PublicKey, error) {
-	block, _ := pem.Decode([]byte(pemString))
-	derBytes := block.Bytes
-	var pki publicKeyInfo
-	if rest, err := asn1.Unmarshal(derBytes, &pki); err != nil {
-		if _, err := asn1.Unmarshal(derBytes, &pkcs1PublicKey{}); err == nil {
-			return nil, errors.New("x509: failed to parse public key (use ParsePKCS1PublicKey instead for this key format)")
-		}
-		return nil, err
-	} else if len(rest) != 0 {
-		return nil, errors.New("x509: trailing data after ASN.1 of public-key")
+// recoveryID computes the recovery id of the signature (r, s) made by pub over
+// digest with a single public key recovery.
+//
+// Recovering with id 0 assumes the nonce point R has an even y coordinate. If
+// that does not yield pub, the id can only be 1, which is confirmed without a
+// second recovery: the keys recovered for both ids satisfy
+// Q0 + Q1 = -2 * r^-1 * e * G.
+func recoveryID(pub *ecdsa.PublicKey, digest []byte, r, s *big.Int) (byte, error) {
+	sig := make([]byte, 65)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:64])
+	q0, err := crypto.Ecrecover(digest, sig)
+	if err != nil {
+		return 0, err
 	}
-
-	if !pki.Algorithm.Algorithm.Equal(OidPublicKeyECDSA) {
-		return nil, errors.New("x509: not a ECDSA public key")
+	if bytes.Equal(q0, crypto.FromECDSAPub(pub)) {
+		return 0, nil
 	}
 
-	der := cryptobyte.String(pki.PublicKey.RightAlign())
-	paramsDer := cryptobyte.String(pki.Algorithm.Parameters.FullBytes)
-	namedCurveOID := new(asn1.ObjectIdentifier)
-	if !paramsDer.ReadASN1ObjectIdentifier(namedCurveOID) {
-		return nil, errors.New("x509: invalid ECDSA parameters")
+	var rs, e, k secp256k1.ModNScalar
+	if rs.SetByteSlice(r.Bytes()) || rs.IsZero() {
+		return 0, errors.New("invalid sig")
 	}
+	e.SetByteSlice(digest)
+	k.InverseValNonConst(&rs).Mul(&e).Mul(new(secp256k1.ModNScalar).SetInt(2)).Negate()
 
-	if !namedCurveOID.Equal(OidSecp256k1) {
-		return nil, errors.New("x509: not a secp256k1 curve")
+	key0, err := secp256k1.ParsePubKey(q0)
+	if err != nil {
+		return 0, err
 	}
-	curve := crypto.S256()
-
-	x, y := elliptic.Unmarshal(curve, der)
-	if x == nil {
-		return nil, errors.New("x509: failed to unmarshal secp256k1 curve point")
+	var qx, qy secp256k1.FieldVal
+	if qx.SetByteSlice(pub.X.Bytes()) || qy.SetByteSlice(pub.Y.Bytes()) {
+		return 0, errors.New("invalid public key")
+	}
+	var p0, p1, sum, want secp256k1.JacobianPoint
+	key0.AsJacobian(&p0)
+	secp256k1.NewPublicKey(&qx, &qy).AsJacobian(&p1)
+	secp256k1.AddNonConst(&p0, &p1, &sum)
+	secp256k1.ScalarBaseMultNonConst(&k, &want)
+	if sum.Z.IsZero() || want.Z.IsZero() {
+		return 0, errors.New("signature does not match public key")
 	}
-	pub := &ecdsa.PublicKey{
-		Curve: curve,
-		X:     x,
-		Y:     y,
+	sum.ToAffine()
+	want.ToAffine()
+	if !sum.X.Equals(&want.X) || !sum.Y.Equals(&want.Y) {
+		return 0, errors.New("signature does not match public key")
 	}
-	return pub, nil
+	return 1, nil
 }
@@ -0,0 +1,98 @@
+package digestsigner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type testSignature struct {
+	key    *ecdsa.PrivateKey
+	digest []byte
+	r, s   *big.Int
+	v      byte
+}
+
+func newTestSignature(t testing.TB, msg string) testSignature {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := crypto.Keccak256([]byte(msg))
+	sig, err := crypto.Sign(digest, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSignature{
+		key:    key,
+		digest: digest,
+		r:      new(big.Int).SetBytes(sig[:32]),
+		s:      new(big.Int).SetBytes(sig[32:64]),
+		v:      sig[64],
+	}
+}
+
+func TestRecoveryID(t *testing.T) {
+	for i := 0; i < 64; i++ {
+		ts := newTestSignature(t, string(rune(i)))
+		v, err := recoveryID(&ts.key.PublicKey, ts.digest, ts.r, ts.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != ts.v {
+			t.Fatalf("recovery id mismatch: have %d, want %d", v, ts.v)
+		}
+	}
+}
+
+func TestRecoveryIDWrongKey(t *testing.T) {
+	ts := newTestSignature(t, "test")
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recoveryID(&other.PublicKey, ts.digest, ts.r, ts.s); err == nil {
+		t.Fatal("expected error for a signature made by another key")
+	}
+}
+
+// BenchmarkRecoverV compares computing V directly against the trial recovery
+// SignDigest used to do, over signatures with both recovery ids.
+func BenchmarkRecoverV(b *testing.B) {
+	var sigs [2]testSignature
+	for found := 0; found < 2; {
+		ts := newTestSignature(b, "test")
+		if sigs[ts.v].key == nil {
+			sigs[ts.v] = ts
+			found++
+		}
+	}
+
+	b.Run("trial", func(b *testing.B) {
+		sig := make([]byte, 65)
+		for i := 0; i < b.N; i++ {
+			ts := sigs[i%2]
+			address := crypto.PubkeyToAddress(ts.key.PublicKey)
+			ts.r.FillBytes(sig[:32])
+			ts.s.FillBytes(sig[32:64])
+			sig[64] = 27
+			if !verifyDigest(address, ts.digest, sig) {
+				sig[64]++
+				if !verifyDigest(address, ts.digest, sig) {
+					b.Fatal("unable to determine V")
+				}
+			}
+		}
+	})
+	b.Run("direct", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ts := sigs[i%2]
+			if _, err := recoveryID(&ts.key.PublicKey, ts.digest, ts.r, ts.s); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
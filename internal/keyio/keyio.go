@@ -0,0 +1,69 @@
+// Package keyio reads private keys for the command line tools and wipes them
+// from memory once used.
+package keyio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+)
+
+// ErrConflictingSources is returned by ReadHexKey when both a file and an
+// environment variable are given.
+var ErrConflictingSources = errors.New("the key file and environment variable are mutually exclusive")
+
+// ReadHexKey reads a hex encoded private key from file, the environment
+// variable env, or stdin if both are empty, without its 0x prefix. The key is
+// never taken from the command line, where it would be visible to other
+// processes. The caller should Zero the key once parsed.
+func ReadHexKey(file, env string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	switch {
+	case file != "" && env != "":
+		return nil, ErrConflictingSources
+	case file != "":
+		data, err = os.ReadFile(file)
+	case env != "":
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", env)
+		}
+		data = []byte(value)
+	default:
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimPrefix(bytes.TrimSpace(data), []byte("0x"))
+	key := append([]byte(nil), trimmed...)
+	Zero(data)
+	return key, nil
+}
+
+// Zero overwrites b, which held key material.
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// ZeroInt overwrites the words of x, e.g. the scalar of a private key, and
+// sets it to zero. x.SetInt64(0) alone only shortens the slice of words and
+// leaves the old ones in memory.
+func ZeroInt(x *big.Int) {
+	if x == nil {
+		return
+	}
+	words := x.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	x.SetInt64(0)
+}
@@ -0,0 +1,43 @@
+package keyio
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadHexKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte(" 0xabcd\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KEYIO_TEST_KEY", "abcd")
+	for _, tt := range []struct{ file, env string }{{path, ""}, {"", "KEYIO_TEST_KEY"}} {
+		key, err := ReadHexKey(tt.file, tt.env)
+		if err != nil || string(key) != "abcd" {
+			t.Fatalf("have %q, %v, want abcd", key, err)
+		}
+	}
+	if _, err := ReadHexKey(path, "KEYIO_TEST_KEY"); !errors.Is(err, ErrConflictingSources) {
+		t.Fatalf("expected ErrConflictingSources, got %v", err)
+	}
+	if _, err := ReadHexKey("", "KEYIO_TEST_UNSET"); err == nil {
+		t.Fatal("expected an unset variable to fail")
+	}
+}
+
+func TestZeroInt(t *testing.T) {
+	x, _ := new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364140", 16)
+	words := x.Bits()
+	ZeroInt(x)
+	if x.Sign() != 0 {
+		t.Fatalf("have %v, want 0", x)
+	}
+	for i, w := range words {
+		if w != 0 {
+			t.Fatalf("word %d was not overwritten", i)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package kwp implements the AES key wrap with padding algorithm of RFC 5649,
+// as used to import keys into Cloud KMS.
+package kwp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// aivPrefix is the constant half of the alternative initial value.
+var aivPrefix = []byte{0xA6, 0x59, 0x59, 0xA6}
+
+// ErrUnwrap is returned for wrapped data failing its integrity check.
+var ErrUnwrap = errors.New("kwp: integrity check failed")
+
+// Wrap wraps plaintext with the AES key kek.
+func Wrap(kek, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) == 0 || uint64(len(plaintext)) > 0xffffffff {
+		return nil, errors.New("kwp: invalid plaintext length")
+	}
+	n := (len(plaintext) + 7) / 8
+	out := make([]byte, 8+8*n)
+	copy(out[:4], aivPrefix)
+	binary.BigEndian.PutUint32(out[4:8], uint32(len(plaintext)))
+	copy(out[8:], plaintext)
+	if n == 1 {
+		block.Encrypt(out, out)
+		return out, nil
+	}
+	wrap(block, out)
+	return out, nil
+}
+
+// Unwrap unwraps ciphertext with the AES key kek.
+func Unwrap(kek, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < 16 || len(ciphertext)%8 != 0 {
+		return nil, errors.New("kwp: invalid ciphertext length")
+	}
+	n := len(ciphertext)/8 - 1
+	buf := append([]byte{}, ciphertext...)
+	if n == 1 {
+		block.Decrypt(buf, buf)
+	} else {
+		unwrap(block, buf)
+	}
+	mli := int(binary.BigEndian.Uint32(buf[4:8]))
+	ok := subtle.ConstantTimeCompare(buf[:4], aivPrefix) &
+		subtle.ConstantTimeLessOrEq(8*(n-1)+1, mli) & subtle.ConstantTimeLessOrEq(mli, 8*n)
+	if ok != 1 {
+		zero(buf)
+		return nil, ErrUnwrap
+	}
+	var pad byte
+	for _, b := range buf[8+mli:] {
+		pad |= b
+	}
+	if pad != 0 {
+		zero(buf)
+		return nil, ErrUnwrap
+	}
+	return buf[8 : 8+mli], nil
+}
+
+// wrap applies the wrapping process W of RFC 3394 in place to A || R.
+func wrap(block cipher.Block, buf []byte) {
+	n := len(buf)/8 - 1
+	var b [16]byte
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b[:8], buf[:8])
+			copy(b[8:], buf[8*i:8*i+8])
+			block.Encrypt(b[:], b[:])
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(buf[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(buf[8*i:], b[8:])
+		}
+	}
+	zero(b[:])
+}
+
+// unwrap applies the unwrapping process W⁻¹ of RFC 3394 in place to C.
+func unwrap(block cipher.Block, buf []byte) {
+	n := len(buf)/8 - 1
+	var b [16]byte
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(buf[:8])^t)
+			copy(b[8:], buf[8*i:8*i+8])
+			block.Decrypt(b[:], b[:])
+			copy(buf[:8], b[:8])
+			copy(buf[8*i:], b[8:])
+		}
+	}
+	zero(b[:])
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
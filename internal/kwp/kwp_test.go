@@ -0,0 +1,36 @@
+package kwp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors of RFC 5649, section 6.
+func TestRFC5649(t *testing.T) {
+	kek, _ := hex.DecodeString("5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+	for _, tc := range []struct{ key, wrapped string }{
+		{"c37b7e6492584340bed12207808941155068f738", "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a"},
+		{"466f7250617369", "afbeb0f07dfbf5419200f2ccb50bb24f"},
+	} {
+		key, _ := hex.DecodeString(tc.key)
+		wrapped, err := Wrap(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(wrapped) != tc.wrapped {
+			t.Fatalf("wrap %s: have %x, want %s", tc.key, wrapped, tc.wrapped)
+		}
+		unwrapped, err := Unwrap(kek, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Fatalf("unwrap: have %x, want %x", unwrapped, key)
+		}
+		wrapped[len(wrapped)-1] ^= 1
+		if _, err := Unwrap(kek, wrapped); err != ErrUnwrap {
+			t.Fatalf("expected ErrUnwrap for tampered data, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// Package pemutil decodes PEM blocks without losing track of the data
+// pem.Decode skips.
+package pemutil
+
+import (
+	"bytes"
+	"encoding/pem"
+)
+
+var beginMarker = []byte("-----BEGIN")
+
+// Decode decodes the next PEM block in data like pem.Decode, and also returns
+// what was skipped before the block: text, or whole blocks too malformed to
+// decode. If no block is found, block and skipped are nil and rest is data.
+func Decode(data []byte) (block *pem.Block, skipped, rest []byte) {
+	block, rest = pem.Decode(data)
+	if block == nil {
+		return nil, nil, data
+	}
+	// the block starts at the last BEGIN line it consumed, since base64 and
+	// headers cannot contain one
+	consumed := data[:len(data)-len(rest)]
+	return block, consumed[:bytes.LastIndex(consumed, beginMarker)], rest
+}
@@ -0,0 +1,29 @@
+package pemutil
+
+import (
+	"encoding/pem"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	valid := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{1, 2, 3}}))
+	malformed := "-----BEGIN PUBLIC KEY-----\nAQID\n-----END PRIVATE KEY-----\n"
+	for _, tt := range []struct {
+		name, data, skipped string
+	}{
+		{"valid", valid, ""},
+		{"leading text", "junk\n" + valid, "junk\n"},
+		{"malformed block", malformed + valid, malformed},
+	} {
+		block, skipped, rest := Decode([]byte(tt.data + "tail"))
+		if block == nil || block.Type != "PUBLIC KEY" || string(block.Bytes) != "\x01\x02\x03" {
+			t.Fatalf("%s: unexpected block %v", tt.name, block)
+		}
+		if string(skipped) != tt.skipped || string(rest) != "tail" {
+			t.Errorf("%s: skipped %q and left %q", tt.name, skipped, rest)
+		}
+	}
+	if block, skipped, rest := Decode([]byte(malformed)); block != nil || skipped != nil || string(rest) != malformed {
+		t.Errorf("unexpected result %v, %q, %q for a malformed block", block, skipped, rest)
+	}
+}
@@ -0,0 +1,69 @@
+// Command auditverify checks the hash chain and checkpoint signatures of an
+// audit log written by audit.ChainSink, without access to KMS.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/audit"
+)
+
+var (
+	signers = flag.String("signers", "", "comma separated addresses trusted to sign checkpoints (required)")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <audit log>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var trusted []common.Address
+	for _, s := range strings.Split(*signers, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !common.IsHexAddress(s) {
+			log.Fatalf("invalid signer address %q\n", s)
+		}
+		trusted = append(trusted, common.HexToAddress(s))
+	}
+	if len(trusted) == 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), "-signers is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("failed to open audit log: %v\n", err)
+	}
+	defer f.Close()
+
+	res, err := audit.Verify(f, trusted)
+	var tamperErr *audit.TamperError
+	if errors.As(err, &tamperErr) {
+		fmt.Printf("TAMPERED: line %d, seq %d: %s\n", tamperErr.Line, tamperErr.Seq, tamperErr.Reason)
+		fmt.Printf("%d records and %d checkpoints verified before it\n", res.Records, res.Checkpoints)
+		os.Exit(1)
+	}
+	if errors.Is(err, audit.ErrUnsignedHead) {
+		fmt.Printf("UNSIGNED: %d records after the last of %d checkpoints are not covered by a signature, head %s\n", res.Unsigned, res.Checkpoints, res.Head)
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("failed to read audit log: %v\n", err)
+	}
+	fmt.Printf("OK: %d records, %d checkpoints, head %s\n", res.Records, res.Checkpoints, res.Head)
+}
@@ -1,88 +1,92 @@
+// Command hex2der converts a hex encoded secp256k1 private key into a PKCS #8
+// file, in DER or PEM form, and prints the address and public key it holds.
+//
+//	hex2der [-in file | -env var] [-format der|pem] [-o file] < hexkey
 package main
 
 import (
-	"bufio"
-	"crypto/elliptic"
-	"crypto/x509/pkix"
-	"encoding/asn1"
+	"encoding/pem"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"strings"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/internal/keyio"
 )
 
-// pkcs8 reflects an ASN.1, PKCS #8 PrivateKey. See
-// ftp://ftp.rsasecurity.com/pub/pkcs/pkcs-8/pkcs-8v1_2.asn
-// and RFC 5208.
-type pkcs8 struct {
-	Version    int
-	Algo       pkix.AlgorithmIdentifier
-	PrivateKey []byte
-	// optional attributes omitted.
-}
-
-type ecPrivateKey struct {
-	Version       int
-	PrivateKey    []byte
-	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
-	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
-}
-
 var (
-	output = flag.String("o", "key.der", "output file")
+	input  = flag.String("in", "", "file holding the hex encoded private key, read from stdin if neither -in nor -env is set")
+	env    = flag.String("env", "", "environment variable holding the hex encoded private key")
+	format = flag.String("format", "der", "output format, der or pem")
+	output = flag.String("o", "", "output file, key.der or key.pem by default")
 )
 
 func main() {
+	log.SetFlags(0)
 	flag.Parse()
+	if *format != "der" && *format != "pem" {
+		log.Fatalf("unknown output format %q\n", *format)
+	}
+	if *output == "" {
+		*output = "key." + *format
+	}
+	if err := run(); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+}
 
-	reader := bufio.NewReader(os.Stdin)
-	hexkey, err := reader.ReadString('\n')
-	if err != nil && err != io.EOF {
-		log.Fatalf("failed to read hex key: %v\n", err)
+// run converts the key. Key material is wiped by its deferred calls, which
+// log.Fatalf would skip.
+func run() error {
+	hexkey, err := keyio.ReadHexKey(*input, *env)
+	if err != nil {
+		return fmt.Errorf("failed to read hex key: %w", err)
 	}
-	hexkey = strings.TrimSpace(hexkey)
-	pk, err := crypto.HexToECDSA(hexkey)
+	pk, err := crypto.HexToECDSA(string(hexkey))
+	keyio.Zero(hexkey)
 	if err != nil {
-		log.Fatalf("failed to parse hex key: %v\n", err)
+		return fmt.Errorf("failed to parse hex key: %w", err)
 	}
+	defer keyio.ZeroInt(pk.D)
 
-	var privKey pkcs8
-	oidBytes, err := asn1.Marshal(digestsigner.OidSecp256k1)
+	der, err := digestsigner.MarshalPKCS8PrivateKey(pk)
 	if err != nil {
-		log.Fatalf("x509: failed to marshal curve OID: %v\n", err)
+		return err
 	}
-	privKey.Algo = pkix.AlgorithmIdentifier{
-		Algorithm: digestsigner.OidPublicKeyECDSA,
-		Parameters: asn1.RawValue{
-			FullBytes: oidBytes,
-		},
+	defer keyio.Zero(der)
+	out := der
+	if *format == "pem" {
+		out = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		defer keyio.Zero(out)
 	}
 
-	privateKey := make([]byte, (pk.Curve.Params().N.BitLen()+7)/8)
-	privKey.PrivateKey, err = asn1.Marshal(ecPrivateKey{
-		Version:    1,
-		PrivateKey: pk.D.FillBytes(privateKey),
-		PublicKey:  asn1.BitString{Bytes: elliptic.Marshal(pk.Curve, pk.X, pk.Y)},
-	})
-	if err != nil {
-		log.Fatalf("x509: failed to marshal private key: %v\n", err)
+	if err := writeKey(*output, out); err != nil {
+		return err
 	}
-	bytes, err := asn1.Marshal(privKey)
+	fmt.Println("Successfully wrote key to", *output)
+	fmt.Println("Address:   ", crypto.PubkeyToAddress(pk.PublicKey).Hex())
+	fmt.Println("Public key:", hexutil.Encode(crypto.FromECDSAPub(&pk.PublicKey)))
+	return nil
+}
+
+// writeKey writes key to a new file only readable by the owner, refusing to
+// overwrite an existing one.
+func writeKey(path string, key []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
 	if err != nil {
-		log.Fatalf("x509: failed to marshal der: %v\n", err)
+		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	f, err := os.Create(*output)
-	if err != nil {
-		log.Fatalf("failed to create output file: %v\n", err)
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to write to output file: %w", err)
 	}
-	if _, err := f.Write(bytes); err != nil {
-		log.Fatalf("failed to write to output file: %v\n", err)
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write to output file: %w", err)
 	}
-	fmt.Println("Successfully wrote key to", *output)
-
+	return nil
 }
@@ -0,0 +1,343 @@
+// Command keyinspect describes the EC keys in a DER or PEM file: PKCS #8
+// private keys as written by hex2der, SubjectPublicKeyInfo public keys as
+// returned by KMS, and SEC1 EC private keys.
+//
+//	keyinspect [file] < key
+//
+// It prints the curve, the key type, the public key in compressed and
+// uncompressed form, the Ethereum address and fingerprints of each key, and
+// warns about malformed or trailing data. Private keys are never printed.
+package main
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/internal/keyio"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/internal/pemutil"
+)
+
+var curveNames = map[string]string{
+	digestsigner.OidSecp256k1.String(): "secp256k1",
+	"1.2.840.10045.3.1.7":              "P-256",
+	"1.3.132.0.34":                     "P-384",
+	"1.3.132.0.35":                     "P-521",
+}
+
+// nistCurves are the curves other than secp256k1 whose points can be decoded.
+var nistCurves = map[string]elliptic.Curve{
+	"1.2.840.10045.3.1.7": elliptic.P256(),
+	"1.3.132.0.34":        elliptic.P384(),
+	"1.3.132.0.35":        elliptic.P521(),
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	Attributes asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// key is a parsed key. Only the public part is kept.
+type key struct {
+	kind     string
+	curve    asn1.ObjectIdentifier
+	x, y     *big.Int
+	warnings []string
+}
+
+func (k *key) warnf(format string, args ...interface{}) {
+	k.warnings = append(k.warnings, fmt.Sprintf(format, args...))
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	var (
+		data []byte
+		err  error
+	)
+	if flag.NArg() > 0 {
+		data, err = os.ReadFile(flag.Arg(0))
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		log.Fatalf("failed to read input: %v\n", err)
+	}
+	defer keyio.Zero(data)
+	if n := inspect(os.Stdout, data); n == 0 {
+		os.Exit(1)
+	}
+}
+
+// inspect describes every key in data to w, and returns the number of keys
+// successfully parsed.
+func inspect(w io.Writer, data []byte) int {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		return describe(w, "DER", data)
+	}
+	var n int
+	rest := data
+	for {
+		var block *pem.Block
+		var skipped []byte
+		block, skipped, rest = pemutil.Decode(rest)
+		if block == nil {
+			break
+		}
+		if junk := bytes.TrimSpace(skipped); len(junk) > 0 {
+			fmt.Fprintf(w, "warning: %d bytes of leading or malformed data before PEM block %q\n", len(junk), block.Type)
+		}
+		switch block.Type {
+		case "EC PARAMETERS":
+			fmt.Fprintf(w, "skipping PEM block %q\n\n", block.Type)
+		default:
+			n += describe(w, fmt.Sprintf("PEM %q", block.Type), block.Bytes)
+		}
+		keyio.Zero(block.Bytes)
+	}
+	if junk := bytes.TrimSpace(rest); len(junk) > 0 {
+		fmt.Fprintf(w, "warning: %d bytes of trailing or malformed data after the last PEM block\n", len(junk))
+	}
+	if n == 0 {
+		fmt.Fprintln(w, "error: no valid PEM block found")
+	}
+	return n
+}
+
+// describe parses a single DER encoded key and prints it to w, returning
+// whether it was parsed.
+func describe(w io.Writer, source string, der []byte) int {
+	k, err := parse(der)
+	if err != nil {
+		fmt.Fprintf(w, "error: %s: %v\n\n", source, err)
+		return 0
+	}
+	fmt.Fprintf(w, "Source:       %s\n", source)
+	fmt.Fprintf(w, "Type:         %s\n", k.kind)
+	name := curveNames[k.curve.String()]
+	if name == "" {
+		name = "unknown"
+	}
+	fmt.Fprintf(w, "Curve:        %s (%s)\n", name, k.curve)
+	if k.x != nil {
+		uncompressed, compressed := encodePoint(k)
+		fmt.Fprintf(w, "Public key:   %s\n", hexutil.Encode(uncompressed))
+		fmt.Fprintf(w, "Compressed:   %s\n", hexutil.Encode(compressed))
+		if k.curve.Equal(digestsigner.OidSecp256k1) {
+			fmt.Fprintf(w, "Address:      %s\n", common.BytesToAddress(crypto.Keccak256(uncompressed[1:])[12:]).Hex())
+		}
+		if spki, err := asn1.Marshal(subjectPublicKeyInfo{
+			Algorithm: algorithm(k.curve),
+			PublicKey: asn1.BitString{Bytes: uncompressed, BitLength: 8 * len(uncompressed)},
+		}); err == nil {
+			sum := sha256.Sum256(spki)
+			fmt.Fprintf(w, "SPKI SHA-256: %x\n", sum)
+		}
+		fmt.Fprintf(w, "Key SHA-256:  %x\n", sha256.Sum256(uncompressed))
+	}
+	for _, warning := range k.warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	fmt.Fprintln(w)
+	return 1
+}
+
+// parse tries der as a SubjectPublicKeyInfo, a PKCS #8 and a SEC1 key, in
+// this order.
+func parse(der []byte) (*key, error) {
+	var spki subjectPublicKeyInfo
+	if rest, err := asn1.Unmarshal(der, &spki); err == nil {
+		k := &key{kind: "SubjectPublicKeyInfo public key"}
+		if len(rest) > 0 {
+			k.warnf("%d bytes of trailing data after the public key", len(rest))
+		}
+		if err := k.setAlgorithm(spki.Algorithm); err != nil {
+			return nil, err
+		}
+		if spki.PublicKey.BitLength%8 != 0 {
+			k.warnf("public key bit string is not byte aligned")
+		}
+		if err := k.setPoint(spki.PublicKey.RightAlign()); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+
+	var p8 pkcs8
+	if rest, err := asn1.Unmarshal(der, &p8); err == nil {
+		k := &key{kind: "PKCS #8 private key"}
+		defer keyio.Zero(p8.PrivateKey)
+		if len(rest) > 0 {
+			k.warnf("%d bytes of trailing data after the private key", len(rest))
+		}
+		if p8.Version != 0 {
+			k.warnf("unexpected PKCS #8 version %d", p8.Version)
+		}
+		if err := k.setAlgorithm(p8.Algo); err != nil {
+			return nil, err
+		}
+		var inner ecPrivateKey
+		rest, err := asn1.Unmarshal(p8.PrivateKey, &inner)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC private key in PKCS #8: %w", err)
+		}
+		defer keyio.Zero(inner.PrivateKey)
+		if len(rest) > 0 {
+			k.warnf("%d bytes of trailing data after the inner EC private key", len(rest))
+		}
+		if inner.NamedCurveOID != nil && !inner.NamedCurveOID.Equal(k.curve) {
+			k.warnf("inner curve %s differs from the algorithm curve %s", inner.NamedCurveOID, k.curve)
+		}
+		if err := k.setPrivate(inner); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+
+	var sec1 ecPrivateKey
+	if rest, err := asn1.Unmarshal(der, &sec1); err == nil && len(sec1.PrivateKey) > 0 {
+		k := &key{kind: "SEC1 EC private key"}
+		defer keyio.Zero(sec1.PrivateKey)
+		if len(rest) > 0 {
+			k.warnf("%d bytes of trailing data after the private key", len(rest))
+		}
+		if sec1.NamedCurveOID == nil {
+			return nil, errors.New("SEC1 key without named curve")
+		}
+		k.curve = sec1.NamedCurveOID
+		if err := k.setPrivate(sec1); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	return nil, errors.New("not a SubjectPublicKeyInfo, PKCS #8 or SEC1 EC key")
+}
+
+func (k *key) setAlgorithm(algo pkix.AlgorithmIdentifier) error {
+	if !algo.Algorithm.Equal(digestsigner.OidPublicKeyECDSA) {
+		return fmt.Errorf("algorithm %s is not EC public key %s", algo.Algorithm, digestsigner.OidPublicKeyECDSA)
+	}
+	rest, err := asn1.Unmarshal(algo.Parameters.FullBytes, &k.curve)
+	if err != nil {
+		return fmt.Errorf("invalid EC parameters, only named curves are supported: %w", err)
+	}
+	if len(rest) > 0 {
+		k.warnf("%d bytes of trailing data after the curve parameters", len(rest))
+	}
+	return nil
+}
+
+// setPoint decodes a compressed or uncompressed curve point.
+func (k *key) setPoint(point []byte) error {
+	if k.curve.Equal(digestsigner.OidSecp256k1) {
+		pub, err := secp256k1.ParsePubKey(point)
+		if err != nil {
+			return fmt.Errorf("invalid secp256k1 point: %w", err)
+		}
+		k.x, k.y = pub.X(), pub.Y()
+		return nil
+	}
+	curve, ok := nistCurves[k.curve.String()]
+	if !ok {
+		k.warnf("unsupported curve, the public key is not decoded")
+		return nil
+	}
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		x, y = elliptic.UnmarshalCompressed(curve, point)
+	}
+	if x == nil {
+		return fmt.Errorf("invalid %s point", curveNames[k.curve.String()])
+	}
+	k.x, k.y = x, y
+	return nil
+}
+
+// setPrivate derives the public key of priv and checks it against the
+// embedded one, if any.
+func (k *key) setPrivate(priv ecPrivateKey) error {
+	if priv.Version != 1 {
+		k.warnf("unexpected EC private key version %d", priv.Version)
+	}
+	var curve elliptic.Curve
+	if k.curve.Equal(digestsigner.OidSecp256k1) {
+		curve = crypto.S256()
+	} else if curve = nistCurves[k.curve.String()]; curve == nil {
+		k.warnf("unsupported curve, the public key is not derived")
+		return nil
+	}
+	d := new(big.Int).SetBytes(priv.PrivateKey)
+	defer keyio.ZeroInt(d)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return errors.New("private key out of range")
+	}
+	if size := (curve.Params().N.BitLen() + 7) / 8; len(priv.PrivateKey) != size {
+		k.warnf("private key is %d bytes instead of %d", len(priv.PrivateKey), size)
+	}
+	k.x, k.y = curve.ScalarBaseMult(priv.PrivateKey)
+
+	if len(priv.PublicKey.Bytes) > 0 {
+		embedded := &key{curve: k.curve}
+		if err := embedded.setPoint(priv.PublicKey.RightAlign()); err != nil {
+			k.warnf("embedded public key: %v", err)
+		} else if embedded.x.Cmp(k.x) != 0 || embedded.y.Cmp(k.y) != 0 {
+			k.warnf("embedded public key does not match the private key")
+		}
+	}
+	return nil
+}
+
+// encodePoint returns the uncompressed and compressed SEC1 encodings of the
+// public key.
+func encodePoint(k *key) (uncompressed, compressed []byte) {
+	size := 32
+	if curve, ok := nistCurves[k.curve.String()]; ok {
+		size = (curve.Params().BitSize + 7) / 8
+	}
+	uncompressed = make([]byte, 1+2*size)
+	uncompressed[0] = 4
+	k.x.FillBytes(uncompressed[1 : 1+size])
+	k.y.FillBytes(uncompressed[1+size:])
+	compressed = make([]byte, 1+size)
+	compressed[0] = 2 | byte(k.y.Bit(0))
+	k.x.FillBytes(compressed[1:])
+	return uncompressed, compressed
+}
+
+func algorithm(curve asn1.ObjectIdentifier) pkix.AlgorithmIdentifier {
+	params, _ := asn1.Marshal(curve)
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  digestsigner.OidPublicKeyECDSA,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner"
+)
+
+func TestInspect(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	pkcs8DER, err := digestsigner.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spkiDER, err := digestsigner.PubkeyToDER(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := crypto.CompressPubkey(&key.PublicKey)
+	compressedDER := mustMarshal(t, subjectPublicKeyInfo{
+		Algorithm: algorithm(digestsigner.OidSecp256k1),
+		PublicKey: asn1.BitString{Bytes: compressed, BitLength: 8 * len(compressed)},
+	})
+	sec1 := func(pub *ecdsa.PublicKey) []byte {
+		point := crypto.FromECDSAPub(pub)
+		return mustMarshal(t, ecPrivateKey{
+			Version:       1,
+			PrivateKey:    crypto.FromECDSA(key),
+			NamedCurveOID: digestsigner.OidSecp256k1,
+			PublicKey:     asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+		})
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p256DER, err := x509.MarshalECPrivateKey(p256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	malformed := "-----BEGIN PUBLIC KEY-----\nAQID\n-----END PRIVATE KEY-----\n"
+	pemOf := func(typ string, der []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+	}
+
+	for _, tt := range []struct {
+		name     string
+		data     string
+		keys     int
+		contains []string
+	}{
+		{"pkcs8 der", string(pkcs8DER), 1, []string{"PKCS #8 private key", address}},
+		{"pkcs8 pem", pemOf("PRIVATE KEY", pkcs8DER), 1, []string{"PKCS #8 private key", address}},
+		{"spki uncompressed", string(spkiDER), 1, []string{"SubjectPublicKeyInfo public key", address}},
+		{"spki compressed", string(compressedDER), 1, []string{"SubjectPublicKeyInfo public key", address}},
+		{"sec1", pemOf("EC PRIVATE KEY", sec1(&key.PublicKey)), 1, []string{"SEC1 EC private key", address}},
+		{"sec1 p256", pemOf("EC PRIVATE KEY", p256DER), 1, []string{"Curve:        P-256"}},
+		{"multiple", pemOf("PUBLIC KEY", spkiDER) + pemOf("PRIVATE KEY", pkcs8DER), 2, nil},
+		{"trailing der", string(spkiDER) + "\x00", 1, []string{"warning: 1 bytes of trailing data after the public key"}},
+		{"trailing pem", pemOf("PUBLIC KEY", spkiDER) + "junk\n\n", 1, []string{"warning: 4 bytes of trailing or malformed data"}},
+		{"leading pem", "junk\n" + pemOf("PUBLIC KEY", spkiDER), 1, []string{"warning: 4 bytes of leading or malformed data before PEM block"}},
+		{"malformed pem", malformed + pemOf("PUBLIC KEY", spkiDER), 1, []string{fmt.Sprintf("warning: %d bytes of leading or malformed data before PEM block", len(strings.TrimSpace(malformed)))}},
+		{"mismatched public key", pemOf("EC PRIVATE KEY", sec1(&other.PublicKey)), 1, []string{"warning: embedded public key does not match the private key", address}},
+		{"garbage", "garbage", 0, []string{"error: DER"}},
+		{"no pem block", "-----BEGIN", 0, []string{"warning: 10 bytes of trailing or malformed data", "error: no valid PEM block found"}},
+	} {
+		var out bytes.Buffer
+		if n := inspect(&out, []byte(tt.data)); n != tt.keys {
+			t.Errorf("%s: have %d keys, want %d:\n%s", tt.name, n, tt.keys, out.String())
+		}
+		for _, s := range tt.contains {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("%s: output lacks %q:\n%s", tt.name, s, out.String())
+			}
+		}
+		if strings.Contains(out.String(), "warning") && !strings.Contains(strings.Join(tt.contains, "\n"), "warning") {
+			t.Errorf("%s: unexpected warning:\n%s", tt.name, out.String())
+		}
+	}
+}
+
+func mustMarshal(t testing.TB, v interface{}) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
@@ -0,0 +1,192 @@
+// Command kmsctl manages the Cloud KMS keys used by digestsigner.
+//
+//	kmsctl provision -project p -location l -keyring r -key k [-protection hsm|software] [-label k=v]...
+//	kmsctl import -project p -location l -keyring r -key k [-import-job j] [-key-file f | -key-env v] < hexkey
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/internal/keyio"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+type command struct {
+	run   func(args []string)
+	usage string
+}
+
+var commands = map[string]command{
+	"provision": {provision, "create a key ring and secp256k1 signing key, unless they exist"},
+	"import":    {importKey, "import a hex encoded secp256k1 private key as a new key version"},
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s <command> [flags]\n\ncommands:\n", os.Args[0])
+		for name, cmd := range commands {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %-10s %s\n", name, cmd.usage)
+		}
+	}
+	flag.Parse()
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd.run(flag.Args()[1:])
+}
+
+// keyFlags are the flags naming a key.
+type keyFlags struct {
+	project, location, keyRing, key string
+}
+
+func (k *keyFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&k.project, "project", "", "GCP project id")
+	fs.StringVar(&k.location, "location", "", "KMS location, e.g. us-east4")
+	fs.StringVar(&k.keyRing, "keyring", "", "key ring name")
+	fs.StringVar(&k.key, "key", "", "key name")
+}
+
+func (k *keyFlags) cred() *digestsigner.KMSCred {
+	return &digestsigner.KMSCred{ProjectID: k.project, Location: k.location, KeyRing: k.keyRing, Key: k.key}
+}
+
+// labelFlags collects repeated -label name=value flags.
+type labelFlags map[string]string
+
+func (l labelFlags) String() string {
+	var pairs []string
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l labelFlags) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("label %q is not name=value", s)
+	}
+	l[name] = value
+	return nil
+}
+
+// protectionFlag is a -protection flag, accepting the protection levels
+// digestsigner supports.
+type protectionFlag kmspb.ProtectionLevel
+
+func (p *protectionFlag) String() string {
+	return strings.ToLower(kmspb.ProtectionLevel(*p).String())
+}
+
+func (p *protectionFlag) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "hsm":
+		*p = protectionFlag(kmspb.ProtectionLevel_HSM)
+	case "software":
+		*p = protectionFlag(kmspb.ProtectionLevel_SOFTWARE)
+	default:
+		return fmt.Errorf("protection level %q is neither hsm nor software", s)
+	}
+	return nil
+}
+
+func provision(args []string) {
+	fs := flag.NewFlagSet("provision", flag.ExitOnError)
+	var key keyFlags
+	key.register(fs)
+	protection := protectionFlag(kmspb.ProtectionLevel_HSM)
+	fs.Var(&protection, "protection", "protection level of the key, hsm or software")
+	labels := labelFlags{}
+	fs.Var(labels, "label", "label name=value of the key, may be repeated")
+	timeout := fs.Duration("timeout", 2*time.Minute, "timeout of the whole operation")
+	fs.Parse(args) //nolint:errcheck
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	cred, address, err := digestsigner.Provision(ctx, key.cred(), digestsigner.ProvisionOptions{
+		ProtectionLevel: kmspb.ProtectionLevel(protection),
+		Labels:          labels,
+	})
+	if err != nil {
+		log.Fatalf("failed to provision key: %v\n", err)
+	}
+	printKey(cred, address.Hex())
+}
+
+func importKey(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var key keyFlags
+	key.register(fs)
+	protection := protectionFlag(kmspb.ProtectionLevel_HSM)
+	fs.Var(&protection, "protection", "protection level of the key, hsm or software")
+	importJob := fs.String("import-job", "", "import job to reuse or create, a new one is created if empty")
+	keyFile := fs.String("key-file", "", "file holding the hex encoded private key, read from stdin if neither -key-file nor -key-env is set")
+	keyEnv := fs.String("key-env", "", "environment variable holding the hex encoded private key")
+	labels := labelFlags{}
+	fs.Var(labels, "label", "label name=value of the key if it is created, may be repeated")
+	timeout := fs.Duration("timeout", 5*time.Minute, "timeout of the whole operation")
+	fs.Parse(args) //nolint:errcheck
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	cred, address, err := importHexKey(ctx, key.cred(), *keyFile, *keyEnv, digestsigner.ImportOptions{
+		ImportJobID:     *importJob,
+		ProtectionLevel: kmspb.ProtectionLevel(protection),
+		Labels:          labels,
+	})
+	if err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	printKey(cred, address.Hex())
+}
+
+// importHexKey reads a hex encoded private key from keyFile, keyEnv or stdin
+// and imports it. The key is wiped before returning, since log.Fatalf would
+// skip deferred calls.
+func importHexKey(ctx context.Context, cred *digestsigner.KMSCred, keyFile, keyEnv string, opts digestsigner.ImportOptions) (*digestsigner.KMSCred, common.Address, error) {
+	hexkey, err := keyio.ReadHexKey(keyFile, keyEnv)
+	if err != nil {
+		return nil, common.Address{}, fmt.Errorf("failed to read hex key: %w", err)
+	}
+	pk, err := crypto.HexToECDSA(string(hexkey))
+	keyio.Zero(hexkey)
+	if err != nil {
+		return nil, common.Address{}, fmt.Errorf("failed to parse hex key: %w", err)
+	}
+	defer keyio.ZeroInt(pk.D)
+	cred, address, err := digestsigner.ImportKey(ctx, cred, pk, opts)
+	if err != nil {
+		return nil, common.Address{}, fmt.Errorf("failed to import key: %w", err)
+	}
+	return cred, address, nil
+}
+
+// printKey prints the credential of a key and its address as JSON.
+func printKey(cred *digestsigner.KMSCred, address string) {
+	out, err := json.MarshalIndent(struct {
+		ProjectID  string
+		Location   string
+		KeyRing    string
+		Key        string
+		KeyVersion string `json:",omitempty"`
+		Address    string
+	}{cred.ProjectID, cred.Location, cred.KeyRing, cred.Key, cred.KeyVersion, address}, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(out))
+}
@@ -0,0 +1,381 @@
+package walletsigner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/wfblockchain/gcp-kms-signer-dlt/audit"
+)
+
+// DefaultApprovalTTL is how long a request stays open for approvals if
+// ApprovalConfig.TTL is not set.
+const DefaultApprovalTTL = 24 * time.Hour
+
+var (
+	// ErrApprovalRequired matches every *ApprovalRequiredError.
+	ErrApprovalRequired = errors.New("approval required")
+	// ErrUnknownApproval is returned for an id without approval request.
+	ErrUnknownApproval = errors.New("unknown approval request")
+	// ErrApprovalExpired is returned when approving an expired request.
+	ErrApprovalExpired = errors.New("approval request expired")
+	// ErrApprovalCancelled is returned for a cancelled request.
+	ErrApprovalCancelled = errors.New("approval request cancelled")
+	// ErrNotApprover is returned for an approval not signed by an approver.
+	ErrNotApprover = errors.New("not an approver")
+	// ErrApprovalConsumed is returned when approving a request whose
+	// transaction was already signed, or signing it while it is being signed.
+	ErrApprovalConsumed = errors.New("approval request already consumed")
+)
+
+// ApprovalRequiredError is returned by SignTx for a transaction lacking
+// approvals. Once Quorum approvers approved ID, SignTx signs the same
+// transaction.
+type ApprovalRequiredError struct {
+	ID        common.Hash
+	Approvals int
+	Quorum    int
+	Expires   time.Time
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	return fmt.Sprintf("approval required: request %s has %d of %d approvals, expires %s", e.ID, e.Approvals, e.Quorum, e.Expires.Format(time.RFC3339))
+}
+
+func (e *ApprovalRequiredError) Is(target error) bool {
+	return target == ErrApprovalRequired
+}
+
+// ApprovalConfig configures which transactions need approvals, and from whom.
+type ApprovalConfig struct {
+	Approvers []common.Address // addresses of the operators approving requests
+	Quorum    int              // approvals needed, at most len(Approvers)
+
+	Threshold       *Wei                    // (Optional) value above which a transaction needs approvals, every transaction does if nil and TokenThresholds is empty
+	TokenThresholds map[common.Address]*Wei // (Optional) ERC-20 amounts above which a transfer, approve or increaseAllowance call needs approvals
+	TTL             time.Duration           // (Optional) how long requests accept approvals, defaults to DefaultApprovalTTL
+}
+
+// ApprovalRequest is a transaction parked until it has been approved.
+type ApprovalRequest struct {
+	ID        common.Hash                      `json:"id"`
+	Address   common.Address                   `json:"address"`
+	ChainID   *hexutil.Big                     `json:"chain_id"`
+	Tx        hexutil.Bytes                    `json:"tx"` // binary encoding of the unsigned transaction
+	Summary   *audit.TxSummary                 `json:"summary"`
+	Created   time.Time                        `json:"created"`
+	Expires   time.Time                        `json:"expires"`
+	Approvals map[common.Address]hexutil.Bytes `json:"approvals,omitempty"` // approver to signature of ApprovalMessage
+	Cancelled bool                             `json:"cancelled,omitempty"`
+	Consumed  bool                             `json:"consumed,omitempty"` // set once the approved transaction is signed
+	Signing   string                           `json:"signing,omitempty"`  // token of the call signing the consumed request, until it is done
+}
+
+// Transaction decodes the transaction awaiting approval.
+func (r *ApprovalRequest) Transaction() (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(r.Tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// ApprovalStore persists approval requests.
+type ApprovalStore interface {
+	// Update atomically replaces the request with id by the result of fn,
+	// which receives nil if there is none. The request is deleted if fn
+	// returns nil, and nothing is changed if fn fails.
+	Update(id common.Hash, fn func(*ApprovalRequest) (*ApprovalRequest, error)) error
+	// List returns every stored request.
+	List() ([]*ApprovalRequest, error)
+}
+
+// Approvals gates signing on M-of-N approvals.
+type Approvals struct {
+	cfg       ApprovalConfig
+	approvers map[common.Address]bool
+	store     ApprovalStore
+	now       func() time.Time
+}
+
+// NewApprovals creates the approval workflow, keeping the requests in store,
+// e.g. a MemoryApprovalStore or a FileApprovalStore.
+func NewApprovals(cfg ApprovalConfig, store ApprovalStore) (*Approvals, error) {
+	approvers := map[common.Address]bool{}
+	for _, addr := range cfg.Approvers {
+		approvers[addr] = true
+	}
+	if cfg.Quorum <= 0 || cfg.Quorum > len(approvers) {
+		return nil, fmt.Errorf("quorum %d is not between 1 and the %d approvers", cfg.Quorum, len(approvers))
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultApprovalTTL
+	}
+	return &Approvals{cfg: cfg, approvers: approvers, store: store, now: time.Now}, nil
+}
+
+// SetApprovals sets the approvals transactions need to be signed by SignTx
+// and SignTxs.
+func (s *Signer) SetApprovals(a *Approvals) {
+	s.approvals = a
+}
+
+// ApprovalID returns the id of the approval request of tx, signed by address
+// with the transaction signer of chainID.
+func ApprovalID(address common.Address, tx *types.Transaction, chainID *big.Int) common.Hash {
+	h := types.LatestSignerForChainID(chainID).Hash(tx)
+	return crypto.Keccak256Hash([]byte("approval"), address[:], h[:])
+}
+
+// ApprovalMessage returns the text approvers sign, e.g. with SignText or
+// personal_sign, to approve the request with id.
+func ApprovalMessage(id common.Hash) []byte {
+	return []byte("Approve signing request " + id.Hex())
+}
+
+// Approve records the approval of the request with id by the signer of sig,
+// a signature of ApprovalMessage(id).
+func (a *Approvals) Approve(id common.Hash, sig []byte) (*ApprovalRequest, error) {
+	approver, err := recoverApprover(id, sig)
+	if err != nil {
+		return nil, err
+	}
+	if !a.approvers[approver] {
+		return nil, fmt.Errorf("%w: %s", ErrNotApprover, approver)
+	}
+	var result *ApprovalRequest
+	err = a.store.Update(id, func(req *ApprovalRequest) (*ApprovalRequest, error) {
+		switch {
+		case req == nil:
+			return nil, ErrUnknownApproval
+		case req.Cancelled:
+			return nil, ErrApprovalCancelled
+		case req.Consumed:
+			return nil, ErrApprovalConsumed
+		case !a.now().Before(req.Expires):
+			return nil, ErrApprovalExpired
+		}
+		if req.Approvals == nil {
+			req.Approvals = map[common.Address]hexutil.Bytes{}
+		}
+		req.Approvals[approver] = common.CopyBytes(sig)
+		result = req
+		return req, nil
+	})
+	return result, err
+}
+
+// Cancel cancels the request with id, so the transaction will not be signed.
+// Once the request expires, signing the transaction again opens a new one.
+func (a *Approvals) Cancel(id common.Hash) error {
+	return a.store.Update(id, func(req *ApprovalRequest) (*ApprovalRequest, error) {
+		if req == nil {
+			return nil, ErrUnknownApproval
+		}
+		req.Cancelled = true
+		return req, nil
+	})
+}
+
+// Pending returns the open requests, oldest first.
+func (a *Approvals) Pending() ([]*ApprovalRequest, error) {
+	reqs, err := a.store.List()
+	if err != nil {
+		return nil, err
+	}
+	now := a.now()
+	pending := reqs[:0]
+	for _, req := range reqs {
+		if !req.Cancelled && !req.Consumed && now.Before(req.Expires) {
+			pending = append(pending, req)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Created.Before(pending[j].Created) })
+	return pending, nil
+}
+
+// Prune deletes the requests that expired, were cancelled and expired, or
+// whose transaction was signed. It is called whenever a request is opened.
+func (a *Approvals) Prune() error {
+	reqs, err := a.store.List()
+	if err != nil {
+		return err
+	}
+	now := a.now()
+	done := func(req *ApprovalRequest) bool {
+		return req != nil && (!now.Before(req.Expires) || req.Consumed && req.Signing == "")
+	}
+	for _, req := range reqs {
+		if !done(req) {
+			continue
+		}
+		err := a.store.Update(req.ID, func(req *ApprovalRequest) (*ApprovalRequest, error) {
+			if done(req) {
+				return nil, nil
+			}
+			return req, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkApproval checks that tx has been approved if it needs to, returning
+// the function to call with the outcome of signing it.
+func (s *Signer) checkApproval(ctx context.Context, account accounts.Account, tx *types.Transaction, chainID *big.Int) (func(signed bool), error) {
+	if s.approvals == nil || !s.approvals.required(tx) {
+		return func(bool) {}, nil
+	}
+	_, span := s.startSpan(ctx, "Approval", account)
+	id, token, err := s.approvals.check(account.Address, tx, chainID)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return func(signed bool) {
+		if err := s.approvals.finish(id, token, signed); err != nil {
+			log.Error("failed to record approval outcome", "address", account.Address, "id", id, "signed", signed, "err", err)
+		}
+	}, nil
+}
+
+// required returns whether tx needs approvals.
+func (a *Approvals) required(tx *types.Transaction) bool {
+	if a.cfg.Threshold == nil && len(a.cfg.TokenThresholds) == 0 {
+		return true
+	}
+	if a.cfg.Threshold != nil && tx.Value().Cmp(a.cfg.Threshold.ToInt()) > 0 {
+		return true
+	}
+	if token, amount := decodeTokenTransfer(tx); token != nil {
+		if max, ok := a.cfg.TokenThresholds[*token]; ok && amount.Cmp(max.ToInt()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// check parks tx as a request unless it already reached the quorum, in which
+// case the request is consumed so its approvals are used only once, and the
+// token to pass to finish is returned. An expired request, or one whose
+// transaction was signed, is opened again without its approvals.
+func (a *Approvals) check(address common.Address, tx *types.Transaction, chainID *big.Int) (common.Hash, string, error) {
+	id := ApprovalID(address, tx, chainID)
+	token, err := newSigningToken()
+	if err != nil {
+		return id, "", err
+	}
+	now := a.now()
+	var approvals int
+	var expires time.Time
+	var opened bool
+	err = a.store.Update(id, func(req *ApprovalRequest) (*ApprovalRequest, error) {
+		expired := req != nil && !now.Before(req.Expires)
+		switch {
+		case req != nil && req.Cancelled && !expired:
+			return nil, ErrApprovalCancelled
+		case req != nil && req.Signing != "" && !expired:
+			return nil, fmt.Errorf("%w: request %s is being signed", ErrApprovalConsumed, id)
+		}
+		opened = req == nil || req.Consumed || expired
+		if opened {
+			data, err := tx.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			req = &ApprovalRequest{
+				ID:      id,
+				Address: address,
+				ChainID: (*hexutil.Big)(chainID),
+				Tx:      data,
+				Summary: audit.SummarizeTx(tx, chainID),
+				Created: now,
+				Expires: now.Add(a.cfg.TTL),
+			}
+		}
+		approvals = a.count(req)
+		expires = req.Expires
+		if approvals >= a.cfg.Quorum {
+			req.Consumed, req.Signing = true, token
+		}
+		return req, nil
+	})
+	if err != nil {
+		return id, "", err
+	}
+	if opened {
+		if err := a.Prune(); err != nil {
+			log.Warn("failed to prune approval requests", "err", err)
+		}
+	}
+	if approvals < a.cfg.Quorum {
+		return id, "", &ApprovalRequiredError{ID: id, Approvals: approvals, Quorum: a.cfg.Quorum, Expires: expires}
+	}
+	return id, token, nil
+}
+
+// finish keeps the request with id consumed if its transaction was signed,
+// and gives its approvals back otherwise. Nothing is changed unless the
+// request is still being signed with token.
+func (a *Approvals) finish(id common.Hash, token string, signed bool) error {
+	return a.store.Update(id, func(req *ApprovalRequest) (*ApprovalRequest, error) {
+		if req == nil || req.Signing != token {
+			return req, nil
+		}
+		req.Consumed, req.Signing = signed, ""
+		return req, nil
+	})
+}
+
+// newSigningToken returns a random token identifying a call signing a
+// consumed request.
+func newSigningToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// count returns the number of valid approvals of req by current approvers.
+func (a *Approvals) count(req *ApprovalRequest) int {
+	n := 0
+	for approver, sig := range req.Approvals {
+		if !a.approvers[approver] {
+			continue
+		}
+		if signer, err := recoverApprover(req.ID, sig); err == nil && signer == approver {
+			n++
+		}
+	}
+	return n
+}
+
+func recoverApprover(id common.Hash, sig []byte) (common.Address, error) {
+	if len(sig) != 65 {
+		return common.Address{}, fmt.Errorf("invalid approval signature length %d", len(sig))
+	}
+	sig = common.CopyBytes(sig)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(ApprovalMessage(id)), sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid approval signature: %w", err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
@@ -0,0 +1,269 @@
+package walletsigner
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func signApproval(t *testing.T, key *ecdsa.PrivateKey, id common.Hash) []byte {
+	t.Helper()
+	sig, err := crypto.Sign(accounts.TextHash(ApprovalMessage(id)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestApprovals(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var approvers []common.Address
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		approvers = append(approvers, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	path := filepath.Join(t.TempDir(), "approvals.json")
+	store, err := NewFileApprovalStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	threshold := Wei(*big.NewInt(params.Ether))
+	cfg := ApprovalConfig{Approvers: approvers, Quorum: 2, Threshold: &threshold, TTL: time.Hour}
+	approvals, err := NewApprovals(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	approvals.now = func() time.Time { return now }
+
+	signer := newTestSigner(t)
+	signer.SetApprovals(approvals)
+	account := signer.Accounts()[0]
+	chainID := big.NewInt(1)
+	to := common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03")
+
+	small := types.NewTransaction(0, to, big.NewInt(params.Ether), 21000, big.NewInt(1), nil)
+	if _, err := signer.SignTx(account, small, chainID); err != nil {
+		t.Fatalf("transaction below the threshold: %v", err)
+	}
+
+	large := types.NewTransaction(1, to, big.NewInt(2*params.Ether), 21000, big.NewInt(1), nil)
+	_, err = signer.SignTx(account, large, chainID)
+	var required *ApprovalRequiredError
+	if !errors.As(err, &required) || !errors.Is(err, ErrApprovalRequired) || required.Approvals != 0 {
+		t.Fatalf("expected approval to be required, got %v", err)
+	}
+	id := required.ID
+	if id != ApprovalID(account.Address, large, chainID) {
+		t.Fatalf("unexpected id %s", id)
+	}
+
+	outsider, _ := crypto.GenerateKey()
+	if _, err := approvals.Approve(id, signApproval(t, outsider, id)); !errors.Is(err, ErrNotApprover) {
+		t.Fatalf("expected ErrNotApprover, got %v", err)
+	}
+	if _, err := approvals.Approve(common.Hash{1}, signApproval(t, keys[0], common.Hash{1})); !errors.Is(err, ErrUnknownApproval) {
+		t.Fatalf("expected ErrUnknownApproval, got %v", err)
+	}
+	for i := 0; i < 2; i++ { // approving twice does not count twice
+		if _, err := approvals.Approve(id, signApproval(t, keys[0], id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := signer.SignTx(account, large, chainID); !errors.As(err, &required) || required.Approvals != 1 {
+		t.Fatalf("expected 1 of 2 approvals, got %v", err)
+	}
+
+	// the pending request survives a restart
+	store, err = NewFileApprovalStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approvals.store = store
+	pending, err := approvals.Pending()
+	if err != nil || len(pending) != 1 || pending[0].ID != id || pending[0].Summary.Value.ToInt().Cmp(large.Value()) != 0 {
+		t.Fatalf("unexpected pending requests %v, %v", pending, err)
+	}
+	if _, err := approvals.Approve(id, signApproval(t, keys[2], id)); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signer.SignTx(account, large, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Nonce() != 1 {
+		t.Fatalf("unexpected transaction %v", signed)
+	}
+
+	// approvals are used once
+	if pending, err := approvals.Pending(); err != nil || len(pending) != 0 {
+		t.Fatalf("expected the signed request to leave the pending ones, got %v, %v", pending, err)
+	}
+	if _, err := approvals.Approve(id, signApproval(t, keys[1], id)); !errors.Is(err, ErrApprovalConsumed) {
+		t.Fatalf("expected ErrApprovalConsumed, got %v", err)
+	}
+	if _, err := signer.SignTx(account, large, chainID); !errors.As(err, &required) || required.Approvals != 0 {
+		t.Fatalf("expected the request to be opened again, got %v", err)
+	}
+
+	// approvals of a transaction failing to be signed are kept
+	unknown := account
+	unknown.Address = common.Address{1}
+	signer.SignTx(unknown, large, chainID)
+	unknownID := ApprovalID(unknown.Address, large, chainID)
+	for _, key := range keys[:2] {
+		if _, err := approvals.Approve(unknownID, signApproval(t, key, unknownID)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := signer.SignTx(unknown, large, chainID); err == nil || errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("expected signing to fail, got %v", err)
+	}
+	if _, err := approvals.Approve(unknownID, signApproval(t, keys[2], unknownID)); err != nil {
+		t.Fatalf("expected the request to stay approved, got %v", err)
+	}
+
+	// cancelled requests are never signed
+	cancelled := types.NewTransaction(2, to, big.NewInt(2*params.Ether), 21000, big.NewInt(1), nil)
+	signer.SignTx(account, cancelled, chainID)
+	cancelledID := ApprovalID(account.Address, cancelled, chainID)
+	if err := approvals.Cancel(cancelledID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := approvals.Approve(cancelledID, signApproval(t, keys[1], cancelledID)); !errors.Is(err, ErrApprovalCancelled) {
+		t.Fatalf("expected ErrApprovalCancelled, got %v", err)
+	}
+	if _, err := signer.SignTx(account, cancelled, chainID); !errors.Is(err, ErrApprovalCancelled) {
+		t.Fatalf("expected ErrApprovalCancelled, got %v", err)
+	}
+
+	// expired requests lose their approvals
+	expiring := types.NewTransaction(3, to, big.NewInt(2*params.Ether), 21000, big.NewInt(1), nil)
+	signer.SignTx(account, expiring, chainID)
+	expiringID := ApprovalID(account.Address, expiring, chainID)
+	if _, err := approvals.Approve(expiringID, signApproval(t, keys[1], expiringID)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := approvals.Approve(expiringID, signApproval(t, keys[2], expiringID)); !errors.Is(err, ErrApprovalExpired) {
+		t.Fatalf("expected ErrApprovalExpired, got %v", err)
+	}
+	if _, err := signer.SignTx(account, expiring, chainID); !errors.As(err, &required) || required.Approvals != 0 {
+		t.Fatalf("expected the request to be opened again, got %v", err)
+	}
+}
+
+func TestApprovalTokenThresholds(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	token := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	to := common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03")
+	threshold := Wei(*big.NewInt(1000))
+	approvals, err := NewApprovals(ApprovalConfig{
+		Approvers:       []common.Address{crypto.PubkeyToAddress(key.PublicKey)},
+		Quorum:          1,
+		TokenThresholds: map[common.Address]*Wei{token: &threshold},
+	}, NewMemoryApprovalStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		data     []byte
+		required bool
+	}{
+		{transferData(to, 1000), false},
+		{transferData(to, 1001), true},
+		{tokenCallData(approveSelector, to, int64(1001)), true},
+		{tokenCallData(increaseAllowanceSelector, to, int64(1001)), true},
+		{tokenCallData(approveSelector, to, int64(1000)), false},
+	} {
+		tx := types.NewTransaction(0, token, common.Big0, 60000, big.NewInt(1), tt.data)
+		if approvals.required(tx) != tt.required {
+			t.Errorf("%x: expected required to be %v", tt.data, tt.required)
+		}
+	}
+}
+
+func TestApprovalConsumption(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	store := NewMemoryApprovalStore()
+	approvals, err := NewApprovals(ApprovalConfig{Approvers: []common.Address{crypto.PubkeyToAddress(key.PublicKey)}, Quorum: 1, TTL: time.Hour}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	approvals.now = func() time.Time { return now }
+	address := common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03")
+	chainID := big.NewInt(1)
+	tx := types.NewTransaction(0, address, big.NewInt(params.Ether), 21000, big.NewInt(1), nil)
+
+	id, _, err := approvals.check(address, tx, chainID)
+	if !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("expected ErrApprovalRequired, got %v", err)
+	}
+	if _, err := approvals.Approve(id, signApproval(t, key, id)); err != nil {
+		t.Fatal(err)
+	}
+	_, first, err := approvals.check(address, tx, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the request cannot be opened again while it is being signed
+	if _, _, err := approvals.check(address, tx, chainID); !errors.Is(err, ErrApprovalConsumed) {
+		t.Fatalf("expected ErrApprovalConsumed, got %v", err)
+	}
+	if err := approvals.finish(id, first, false); err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := approvals.check(address, tx, chainID)
+	if err != nil {
+		t.Fatalf("expected the approvals to be given back, got %v", err)
+	}
+
+	// a stale call does not give back the approvals consumed by another one
+	if err := approvals.finish(id, first, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := approvals.Approve(id, signApproval(t, key, id)); !errors.Is(err, ErrApprovalConsumed) {
+		t.Fatalf("expected ErrApprovalConsumed, got %v", err)
+	}
+	if err := approvals.finish(id, second, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := approvals.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if reqs, _ := store.List(); len(reqs) != 0 {
+		t.Fatalf("expected the signed request to be pruned, got %v", reqs)
+	}
+
+	// a cancelled request refuses the transaction until it expires
+	id, _, _ = approvals.check(address, tx, chainID)
+	if err := approvals.Cancel(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := approvals.check(address, tx, chainID); !errors.Is(err, ErrApprovalCancelled) {
+		t.Fatalf("expected ErrApprovalCancelled, got %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if err := approvals.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if reqs, _ := store.List(); len(reqs) != 0 {
+		t.Fatalf("expected the expired request to be pruned, got %v", reqs)
+	}
+	var required *ApprovalRequiredError
+	if _, _, err := approvals.check(address, tx, chainID); !errors.As(err, &required) || required.Approvals != 0 {
+		t.Fatalf("expected a new request, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package walletsigner
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// MemoryApprovalStore keeps approval requests in memory, so they are lost on
+// restart.
+type MemoryApprovalStore struct {
+	mu   sync.Mutex
+	reqs map[common.Hash]*ApprovalRequest
+}
+
+var _ ApprovalStore = (*MemoryApprovalStore)(nil)
+
+func NewMemoryApprovalStore() *MemoryApprovalStore {
+	return &MemoryApprovalStore{reqs: map[common.Hash]*ApprovalRequest{}}
+}
+
+func (m *MemoryApprovalStore) Update(id common.Hash, fn func(*ApprovalRequest) (*ApprovalRequest, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req, err := fn(copyApprovalRequest(m.reqs[id]))
+	if err != nil {
+		return err
+	}
+	if req == nil {
+		delete(m.reqs, id)
+	} else {
+		m.reqs[id] = copyApprovalRequest(req)
+	}
+	return nil
+}
+
+func (m *MemoryApprovalStore) List() ([]*ApprovalRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reqs := make([]*ApprovalRequest, 0, len(m.reqs))
+	for _, req := range m.reqs {
+		reqs = append(reqs, copyApprovalRequest(req))
+	}
+	return reqs, nil
+}
+
+// FileApprovalStore keeps approval requests in a JSON file, which is
+// atomically replaced on every update.
+type FileApprovalStore struct {
+	path string
+
+	mu   sync.Mutex
+	reqs map[common.Hash]*ApprovalRequest
+}
+
+var _ ApprovalStore = (*FileApprovalStore)(nil)
+
+// NewFileApprovalStore loads the requests stored at path, if it exists.
+func NewFileApprovalStore(path string) (*FileApprovalStore, error) {
+	f := &FileApprovalStore{path: path, reqs: map[common.Hash]*ApprovalRequest{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &f.reqs); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileApprovalStore) Update(id common.Hash, fn func(*ApprovalRequest) (*ApprovalRequest, error)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	req, err := fn(copyApprovalRequest(f.reqs[id]))
+	if err != nil {
+		return err
+	}
+	next := make(map[common.Hash]*ApprovalRequest, len(f.reqs)+1)
+	for k, v := range f.reqs {
+		next[k] = v
+	}
+	if req == nil {
+		delete(next, id)
+	} else {
+		next[id] = copyApprovalRequest(req)
+	}
+	if err := writeFileAtomic(f.path, next); err != nil {
+		return err
+	}
+	f.reqs = next
+	return nil
+}
+
+func (f *FileApprovalStore) List() ([]*ApprovalRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reqs := make([]*ApprovalRequest, 0, len(f.reqs))
+	for _, req := range f.reqs {
+		reqs = append(reqs, copyApprovalRequest(req))
+	}
+	return reqs, nil
+}
+
+// copyApprovalRequest copies the mutable parts of req, so callers cannot
+// change stored requests.
+func copyApprovalRequest(req *ApprovalRequest) *ApprovalRequest {
+	if req == nil {
+		return nil
+	}
+	c := *req
+	if req.Approvals != nil {
+		c.Approvals = make(map[common.Address]hexutil.Bytes, len(req.Approvals))
+		for k, v := range req.Approvals {
+			c.Approvals[k] = v
+		}
+	}
+	return &c
+}
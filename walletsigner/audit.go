@@ -0,0 +1,74 @@
+package walletsigner
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/wfblockchain/gcp-kms-signer-dlt/audit"
+)
+
+// SetAuditSink sets the sink receiving a record of every SignData, SignText,
+// SignTx and SignTxs call. A signature whose record could not be written is
+// not returned.
+func (s *Signer) SetAuditSink(sink audit.Sink) {
+	s.auditSink = sink
+}
+
+// WithAuditMetadata returns a copy of the wallet whose signing requests are
+// recorded with md, e.g. the request or operator triggering them. The
+// metadata is passed on to the DigestSigner too.
+func (s *Signer) WithAuditMetadata(md map[string]string) *Signer {
+	c := *s
+	merged := map[string]string{}
+	for k, v := range s.auditMetadata {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	c.auditMetadata = merged
+	return &c
+}
+
+func (s *Signer) auditContext(ctx context.Context) context.Context {
+	if len(s.auditMetadata) == 0 {
+		return ctx
+	}
+	return audit.WithMetadata(ctx, s.auditMetadata)
+}
+
+// audit writes the record of a signing call, tx being the signed transaction
+// if any. The returned error is only relevant if signErr is nil.
+func (s *Signer) audit(ctx context.Context, op string, account accounts.Account, digest, sig []byte, tx *types.Transaction, chainID *big.Int, signErr error) error {
+	if s.auditSink == nil {
+		return nil
+	}
+	keyVersion, _ := s.kmsSigner.KeyVersion(account.Address)
+	rec := &audit.Record{
+		Time:       time.Now().UTC(),
+		Operation:  op,
+		Address:    account.Address,
+		KeyVersion: keyVersion,
+		Digest:     common.CopyBytes(digest),
+		Signature:  common.CopyBytes(sig),
+		Metadata:   audit.MetadataFromContext(ctx),
+	}
+	if tx != nil {
+		rec.Tx = audit.SummarizeTx(tx, chainID)
+	}
+	if signErr != nil {
+		rec.Error = signErr.Error()
+	}
+	if err := s.auditSink.Write(ctx, rec); err != nil {
+		log.Error("audit record not written", "op", op, "address", account.Address, "err", err)
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
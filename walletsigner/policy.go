@@ -0,0 +1,327 @@
+package walletsigner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the built-in policy rules, as reported by PolicyViolation.
+const (
+	RuleAllowedDestinations = "allowed_destinations"
+	RuleDeniedDestinations  = "denied_destinations"
+	RuleMaxValue            = "max_value"
+	RuleMaxGasPrice         = "max_gas_price"
+	RuleMaxFeeCap           = "max_fee_cap"
+	RuleAllowedChainIDs     = "allowed_chain_ids"
+	RuleAllowedMethods      = "allowed_methods"
+	RuleDataSigning         = "data_signing"
+)
+
+// ErrPolicyViolation matches every *PolicyViolation.
+var ErrPolicyViolation = errors.New("policy violation")
+
+// PolicyViolation is returned by SignTx for a transaction rejected by the
+// policy of the wallet.
+type PolicyViolation struct {
+	Rule    string // name of the rule, e.g. RuleMaxValue
+	Address common.Address
+	Reason  string
+}
+
+func (e *PolicyViolation) Error() string {
+	return fmt.Sprintf("policy violation for %s: %s: %s", e.Address, e.Rule, e.Reason)
+}
+
+func (e *PolicyViolation) Is(target error) bool {
+	return target == ErrPolicyViolation
+}
+
+// Policy decides whether a transaction may be signed. It is evaluated by
+// SignTx and SignTxs before the DigestSigner is called.
+type Policy interface {
+	Check(ctx context.Context, account accounts.Account, tx *types.Transaction, chainID *big.Int) error
+}
+
+// SetPolicy sets the policy transactions must satisfy to be signed.
+func (s *Signer) SetPolicy(p Policy) {
+	s.policy = p
+}
+
+// SetAllowDataSigning allows SignData and SignText while a policy, spend
+// limiter or approvals are set. They are refused by default then, since the
+// data could be the signing hash preimage of a transaction, whose signature
+// would bypass the checks of SignTx.
+func (s *Signer) SetAllowDataSigning(allow bool) {
+	s.allowDataSigning = allow
+}
+
+// checkDataSigning returns a violation if signing arbitrary data would bypass
+// the checks on transactions.
+func (s *Signer) checkDataSigning(account accounts.Account) error {
+	if s.allowDataSigning || (s.policy == nil && s.spendLimiter == nil && s.approvals == nil) {
+		return nil
+	}
+	return &PolicyViolation{Rule: RuleDataSigning, Address: account.Address, Reason: "data signing is not allowed while transactions are restricted"}
+}
+
+func (s *Signer) checkPolicy(ctx context.Context, account accounts.Account, tx *types.Transaction, chainID *big.Int) error {
+	if s.policy == nil {
+		return nil
+	}
+	_, span := s.startSpan(ctx, "Policy", account)
+	err := s.policy.Check(ctx, account, tx, chainID)
+	endSpan(span, err)
+	return err
+}
+
+// Rules are the built-in checks of a RulePolicy. Unset rules are not checked.
+type Rules struct {
+	AllowedDestinations []common.Address `json:"allowed_destinations,omitempty"` // contract creation is denied if set
+	DeniedDestinations  []common.Address `json:"denied_destinations,omitempty"`
+	MaxValue            *Wei             `json:"max_value,omitempty"`
+	MaxGasPrice         *Wei             `json:"max_gas_price,omitempty"` // gas price, or fee cap of dynamic fee transactions without MaxFeeCap
+	MaxFeeCap           *Wei             `json:"max_fee_cap,omitempty"`   // fee cap of dynamic fee transactions, instead of MaxGasPrice
+	AllowedChainIDs     []uint64         `json:"allowed_chain_ids,omitempty"`
+	AllowedMethods      []Selector       `json:"allowed_methods,omitempty"` // transactions without call data are always allowed
+}
+
+// RulePolicy applies Rules per signing address, falling back to Default for
+// addresses without rules of their own. Addresses without any rules are not
+// restricted.
+type RulePolicy struct {
+	Default   *Rules                    `json:"default,omitempty"`
+	Addresses map[common.Address]*Rules `json:"addresses,omitempty"`
+}
+
+var _ Policy = (*RulePolicy)(nil)
+
+// LoadPolicy reads a RulePolicy from a YAML or JSON file. Large wei amounts
+// should be quoted, and may use a unit, e.g. "50 ether" or "30 gwei".
+func LoadPolicy(path string) (*RulePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy parses a RulePolicy from YAML or JSON.
+func ParsePolicy(data []byte) (*RulePolicy, error) {
+	p := &RulePolicy{}
+	if err := decodeConfig(data, p); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return p, nil
+}
+
+// decodeConfig decodes YAML or JSON data into v. YAML is a superset of JSON,
+// so both go through YAML into the JSON decoding of v.
+func decodeConfig(data []byte, v interface{}) error {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// Rules returns the rules applying to address.
+func (p *RulePolicy) Rules(address common.Address) *Rules {
+	if r, ok := p.Addresses[address]; ok {
+		return r
+	}
+	return p.Default
+}
+
+func (p *RulePolicy) Check(ctx context.Context, account accounts.Account, tx *types.Transaction, chainID *big.Int) error {
+	r := p.Rules(account.Address)
+	if r == nil {
+		return nil
+	}
+	violation := func(rule, format string, args ...interface{}) error {
+		return &PolicyViolation{Rule: rule, Address: account.Address, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if len(r.AllowedChainIDs) > 0 && !containsChainID(r.AllowedChainIDs, chainID) {
+		return violation(RuleAllowedChainIDs, "chain id %v is not allowed", chainID)
+	}
+	if to := tx.To(); to == nil {
+		if len(r.AllowedDestinations) > 0 {
+			return violation(RuleAllowedDestinations, "contract creation is not allowed")
+		}
+	} else {
+		if len(r.AllowedDestinations) > 0 && !containsAddress(r.AllowedDestinations, *to) {
+			return violation(RuleAllowedDestinations, "destination %s is not allowed", to)
+		}
+		if containsAddress(r.DeniedDestinations, *to) {
+			return violation(RuleDeniedDestinations, "destination %s is denied", to)
+		}
+	}
+	if r.MaxValue != nil && tx.Value().Cmp(r.MaxValue.ToInt()) > 0 {
+		return violation(RuleMaxValue, "value %v exceeds %v", tx.Value(), r.MaxValue)
+	}
+	switch {
+	case tx.Type() == types.DynamicFeeTxType && r.MaxFeeCap != nil:
+		if tx.GasFeeCap().Cmp(r.MaxFeeCap.ToInt()) > 0 {
+			return violation(RuleMaxFeeCap, "fee cap %v exceeds %v", tx.GasFeeCap(), r.MaxFeeCap)
+		}
+	case r.MaxGasPrice != nil:
+		// the fee cap is the highest gas price a dynamic fee transaction pays,
+		// and the gas price of the other ones
+		if tx.GasFeeCap().Cmp(r.MaxGasPrice.ToInt()) > 0 {
+			return violation(RuleMaxGasPrice, "gas price %v exceeds %v", tx.GasFeeCap(), r.MaxGasPrice)
+		}
+	}
+	if data := tx.Data(); len(r.AllowedMethods) > 0 && len(data) > 0 {
+		if len(data) < 4 {
+			return violation(RuleAllowedMethods, "call data too short for a method selector")
+		}
+		var sel Selector
+		copy(sel[:], data)
+		if !containsSelector(r.AllowedMethods, sel) {
+			return violation(RuleAllowedMethods, "method %s is not allowed", sel)
+		}
+	}
+	return nil
+}
+
+func containsChainID(ids []uint64, chainID *big.Int) bool {
+	for _, id := range ids {
+		if chainID != nil && chainID.IsUint64() && chainID.Uint64() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSelector(sels []Selector, sel Selector) bool {
+	for _, s := range sels {
+		if s == sel {
+			return true
+		}
+	}
+	return false
+}
+
+// Wei is an amount of wei. It is decoded from a number or a string, which
+// may carry a unit of wei, gwei or ether, e.g. "1.5 ether".
+type Wei big.Int
+
+// ToInt returns w as a big.Int.
+func (w *Wei) ToInt() *big.Int {
+	return (*big.Int)(w)
+}
+
+func (w *Wei) String() string {
+	return w.ToInt().String()
+}
+
+func (w *Wei) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	v, err := parseWei(s)
+	if err != nil {
+		return err
+	}
+	*w = Wei(*v)
+	return nil
+}
+
+func (w *Wei) MarshalJSON() ([]byte, error) {
+	return json.Marshal(w.String())
+}
+
+var weiUnits = map[string]*big.Float{
+	"wei":   big.NewFloat(params.Wei),
+	"gwei":  big.NewFloat(params.GWei),
+	"ether": big.NewFloat(params.Ether),
+}
+
+func parseWei(s string) (*big.Int, error) {
+	fields := strings.Fields(s)
+	unit := "wei"
+	switch len(fields) {
+	case 1:
+	case 2:
+		unit = strings.ToLower(fields[1])
+	default:
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	mul, ok := weiUnits[unit]
+	if !ok {
+		return nil, fmt.Errorf("invalid unit %q", unit)
+	}
+	if unit == "wei" {
+		v, ok := new(big.Int).SetString(fields[0], 10)
+		if !ok || v.Sign() < 0 {
+			return nil, fmt.Errorf("invalid amount %q", s)
+		}
+		return v, nil
+	}
+	f, ok := new(big.Float).SetPrec(256).SetString(fields[0])
+	if !ok || f.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	v, acc := f.Mul(f, mul).Int(nil)
+	if acc != big.Exact {
+		return nil, fmt.Errorf("amount %q is not a whole number of wei", s)
+	}
+	return v, nil
+}
+
+// Selector is the 4 byte selector of a contract method. It is decoded from
+// hex, e.g. "0xa9059cbb", or from the method signature, e.g.
+// "transfer(address,uint256)".
+type Selector [4]byte
+
+func (s Selector) String() string {
+	return hexutil.Encode(s[:])
+}
+
+func (s *Selector) UnmarshalText(text []byte) error {
+	str := strings.TrimSpace(string(text))
+	if strings.Contains(str, "(") {
+		copy(s[:], crypto.Keccak256([]byte(strings.ReplaceAll(str, " ", ""))))
+		return nil
+	}
+	b, err := hexutil.Decode(str)
+	if err != nil || len(b) != 4 {
+		return fmt.Errorf("invalid method selector %q", str)
+	}
+	copy(s[:], b)
+	return nil
+}
+
+func (s Selector) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
@@ -0,0 +1,128 @@
+package walletsigner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const testPolicy = `
+default:
+  allowed_chain_ids: [1, 5]
+  max_gas_price: 100 gwei
+addresses:
+  "%s":
+    allowed_destinations: ["0x4549f47920997A486e9986d2e3e4540230534A03", "0xdAC17F958D2ee523a2206206994597C13D831ec7"]
+    denied_destinations: ["0xdAC17F958D2ee523a2206206994597C13D831ec7"]
+    allowed_chain_ids: [1]
+    max_value: "1.5 ether"
+    max_fee_cap: "50 gwei"
+    allowed_methods: ["transfer(address,uint256)", "0x095ea7b3"]
+`
+
+func TestParsePolicyJSON(t *testing.T) {
+	p, err := ParsePolicy([]byte(`{"default": {"max_value": "1000", "allowed_methods": ["0xa9059cbb"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Default.MaxValue.ToInt().Int64() != 1000 || p.Default.AllowedMethods[0].String() != "0xa9059cbb" {
+		t.Fatalf("unexpected policy %+v", p.Default)
+	}
+	if _, err := ParsePolicy([]byte(`{"default": {"max_valeu": "1000"}}`)); err == nil {
+		t.Fatal("expected unknown rules to be rejected")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	signer := newTestSigner(t)
+	account := signer.Accounts()[0]
+	p, err := ParsePolicy([]byte(replaceAddress(testPolicy, account.Address)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.SetPolicy(p)
+
+	allowed := common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03")
+	denied := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	transfer := common.FromHex("0xa9059cbb0000")
+	dynamic := func(to *common.Address, value, feeCap *big.Int, data []byte) *types.Transaction {
+		return types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(1), To: to, Value: value, Gas: 21000, GasFeeCap: feeCap, GasTipCap: big.NewInt(1), Data: data})
+	}
+	gwei := big.NewInt(params.GWei)
+	ether := big.NewInt(params.Ether)
+	for _, tc := range []struct {
+		tx      *types.Transaction
+		chainID int64
+		rule    string
+	}{
+		{dynamic(&allowed, ether, gwei, transfer), 1, ""},
+		{dynamic(&allowed, ether, gwei, nil), 7, RuleAllowedChainIDs},
+		{dynamic(nil, ether, gwei, nil), 1, RuleAllowedDestinations},
+		{dynamic(&common.Address{1}, ether, gwei, nil), 1, RuleAllowedDestinations},
+		{dynamic(&denied, ether, gwei, nil), 1, RuleDeniedDestinations},
+		{dynamic(&allowed, new(big.Int).Mul(ether, big.NewInt(2)), gwei, nil), 1, RuleMaxValue},
+		{dynamic(&allowed, ether, new(big.Int).Mul(gwei, big.NewInt(51)), nil), 1, RuleMaxFeeCap},
+		{dynamic(&allowed, ether, gwei, common.FromHex("0x23b872dd")), 1, RuleAllowedMethods},
+	} {
+		_, err := signer.SignTx(account, tc.tx, big.NewInt(tc.chainID))
+		var violation *PolicyViolation
+		switch {
+		case tc.rule == "" && err != nil:
+			t.Errorf("unexpected error %v", err)
+		case tc.rule != "" && (!errors.As(err, &violation) || violation.Rule != tc.rule || !errors.Is(err, ErrPolicyViolation)):
+			t.Errorf("expected violation of %s, got %v", tc.rule, err)
+		}
+	}
+
+	// the default rules apply to other addresses
+	other := account
+	other.Address = common.Address{2}
+	legacy := types.NewTransaction(0, denied, ether, 21000, new(big.Int).Mul(gwei, big.NewInt(101)), nil)
+	var violation *PolicyViolation
+	if err := p.Check(context.Background(), other, legacy, big.NewInt(5)); !errors.As(err, &violation) || violation.Rule != RuleMaxGasPrice {
+		t.Errorf("expected violation of %s, got %v", RuleMaxGasPrice, err)
+	}
+	// without max_fee_cap, max_gas_price bounds the fee cap of dynamic fee transactions
+	if err := p.Check(context.Background(), other, dynamic(&denied, ether, new(big.Int).Mul(gwei, big.NewInt(101)), nil), big.NewInt(1)); !errors.As(err, &violation) || violation.Rule != RuleMaxGasPrice {
+		t.Errorf("expected violation of %s, got %v", RuleMaxGasPrice, err)
+	}
+	if err := p.Check(context.Background(), other, dynamic(&denied, ether, new(big.Int).Mul(gwei, big.NewInt(100)), nil), big.NewInt(1)); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	_, errs := signer.SignTxs(context.Background(), account, []*types.Transaction{
+		dynamic(&denied, ether, gwei, nil),
+		dynamic(&allowed, ether, gwei, nil),
+	}, big.NewInt(1))
+	if !errors.Is(errs[0], ErrPolicyViolation) || errs[1] != nil {
+		t.Errorf("unexpected errors %v", errs)
+	}
+
+	// the signature of a transaction preimage would bypass the policy
+	preimage, err := rlp.EncodeToBytes([]interface{}{uint64(0), gwei, uint64(21000), denied, ether, []byte{}, big.NewInt(1), uint(0), uint(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.SignData(account, accounts.MimetypeTextPlain, preimage); !errors.As(err, &violation) || violation.Rule != RuleDataSigning {
+		t.Errorf("expected violation of %s, got %v", RuleDataSigning, err)
+	}
+	if _, err := signer.SignText(account, []byte("hello")); !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("expected violation of %s, got %v", RuleDataSigning, err)
+	}
+	signer.SetAllowDataSigning(true)
+	if _, err := signer.SignData(account, accounts.MimetypeTextPlain, preimage); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func replaceAddress(format string, address common.Address) string {
+	return fmt.Sprintf(format, address.Hex())
+}
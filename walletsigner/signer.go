@@ -11,17 +11,30 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/audit"
 	digestsigner "github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ accounts.Wallet = (*Signer)(nil)
 
 type Signer struct {
-	kmsSigner *digestsigner.KMSSigner
-	timeout   time.Duration
+	kmsSigner      digestsigner.DigestSigner
+	timeout        time.Duration
+	tracerProvider trace.TracerProvider
+	auditSink      audit.Sink
+	auditMetadata  map[string]string
+	policy         Policy
+	spendLimiter   *SpendLimiter
+	approvals      *Approvals
+
+	allowDataSigning bool
 }
 
-func NewSigner(ks *digestsigner.KMSSigner, timeout time.Duration) Signer {
+// NewSigner wraps a DigestSigner, e.g. a *digestsigner.KMSSigner, into an
+// accounts.Wallet. Every signing request is bounded by timeout.
+func NewSigner(ks digestsigner.DigestSigner, timeout time.Duration) Signer {
 	signer := Signer{}
 	signer.kmsSigner = ks
 	signer.timeout = timeout
@@ -42,11 +55,7 @@ func (s *Signer) URL() accounts.URL {
 // wallet. It also returns an error indicating any failure the wallet might have
 // encountered.
 func (s *Signer) Status() (string, error) {
-	state := s.kmsSigner.GetConnectionStatus()
-	if state == "INVALID_STATE" {
-		return "", fmt.Errorf("invalid state")
-	}
-	return state, nil
+	return s.kmsSigner.Status()
 }
 
 // Open initializes access to a wallet instance. It is not meant to unlock or
@@ -72,10 +81,17 @@ func (s *Signer) Close() error {
 // Accounts retrieves the list of signing accounts the wallet is currently aware
 // of. For hierarchical deterministic wallets, the list will not be exhaustive,
 // rather only contain the accounts explicitly pinned during account derivation.
+//
+// The accounts are in the order of the DigestSigner, so the first one is the
+// primary account.
 func (s *Signer) Accounts() []accounts.Account {
 	keys := s.kmsSigner.ListVersionedKeys()
 	result := make([]accounts.Account, 0, len(keys))
-	for addr, key := range keys {
+	for _, addr := range s.kmsSigner.GetAddresses() {
+		key, ok := keys[addr]
+		if !ok {
+			continue // removed by a concurrent refresh
+		}
 		result = append(result,
 			accounts.Account{
 				Address: addr,
@@ -125,18 +141,26 @@ func (s *Signer) SelfDerive(bases []accounts.DerivationPath, chain ethereum.Chai
 // about which fields or actions are needed. The user may retry by providing
 // the needed details via SignDataWithPassphrase, or by other means (e.g. unlock
 // the account in a keystore).
-func (s *Signer) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+func (s *Signer) SignData(account accounts.Account, mimeType string, data []byte) (_ []byte, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
 	defer cancel()
+	ctx, span := s.startSpan(s.auditContext(ctx), "SignData", account, AttrMimeType.String(mimeType))
+	defer func() { endSpan(span, err) }()
+
+	_, hashSpan := s.startSpan(ctx, "Hash", account)
 	hashed := crypto.Keccak256(data)
-	res, err := s.kmsSigner.SignDigest(ctx, account.Address, hashed)
-	if err != nil {
-		return nil, err
+	hashSpan.End()
+	var res []byte
+	if err = s.checkDataSigning(account); err == nil {
+		res, err = s.kmsSigner.SignDigest(ctx, account.Address, hashed)
 	}
-	// If V is on 27/28-form, convert to 0/1 for Clique
-	if mimeType == accounts.MimetypeClique && (res[64] == 27 || res[64] == 28) {
+	if err == nil && mimeType == accounts.MimetypeClique && (res[64] == 27 || res[64] == 28) {
+		// If V is on 27/28-form, convert to 0/1 for Clique
 		res[64] -= 27 // Transform V from 27/28 to 0/1 for Clique use
 	}
+	if aerr := s.audit(ctx, audit.OpSignData, account, hashed, res, nil, nil, err); err != nil || aerr != nil {
+		return nil, firstErr(err, aerr)
+	}
 	return res, nil
 }
 
@@ -161,17 +185,25 @@ func (s *Signer) SignDataWithPassphrase(account accounts.Account, passphrase, mi
 // the account in a keystore).
 //
 // This method should return the signature in 'canonical' format, with v 0 or 1.
-func (s *Signer) SignText(account accounts.Account, text []byte) ([]byte, error) {
+func (s *Signer) SignText(account accounts.Account, text []byte) (_ []byte, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
 	defer cancel()
+	ctx, span := s.startSpan(s.auditContext(ctx), "SignText", account)
+	defer func() { endSpan(span, err) }()
+
+	_, hashSpan := s.startSpan(ctx, "Hash", account)
 	hashed := accounts.TextHash(text)
-	res, err := s.kmsSigner.SignDigest(ctx, account.Address, hashed)
-	if err != nil {
-		return nil, err
+	hashSpan.End()
+	var res []byte
+	if err = s.checkDataSigning(account); err == nil {
+		res, err = s.kmsSigner.SignDigest(ctx, account.Address, hashed)
 	}
-	if res[64] == 27 || res[64] == 28 {
+	if err == nil && (res[64] == 27 || res[64] == 28) {
 		res[64] -= 27 // Transform V from Ethereum-legacy to 0/1
 	}
+	if aerr := s.audit(ctx, audit.OpSignText, account, hashed, res, nil, nil, err); err != nil || aerr != nil {
+		return nil, firstErr(err, aerr)
+	}
 	return res, nil
 }
 
@@ -191,19 +223,121 @@ func (s *Signer) SignTextWithPassphrase(account accounts.Account, passphrase str
 // about which fields or actions are needed. The user may retry by providing
 // the needed details via SignTxWithPassphrase, or by other means (e.g. unlock
 // the account in a keystore).
-func (s *Signer) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+func (s *Signer) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (_ *types.Transaction, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
 	defer cancel()
+	ctx, span := s.startSpan(s.auditContext(ctx), "SignTx", account, chainIDAttr(chainID), AttrTxType.Int(int(tx.Type())))
+	defer func() { endSpan(span, err) }()
+
 	signer := types.LatestSignerForChainID(chainID)
+	_, hashSpan := s.startSpan(ctx, "Hash", account)
 	h := signer.Hash(tx)
+	hashSpan.End()
+	done, err := s.admitTx(ctx, account, tx, chainID)
+	if err != nil {
+		return s.finishTx(ctx, account, signer, tx, chainID, h[:], nil, err)
+	}
 	res, err := s.kmsSigner.SignDigest(ctx, account.Address, h[:])
+	signed, err := s.finishTx(ctx, account, signer, tx, chainID, h[:], res, err)
+	done(err == nil)
+	return signed, err
+}
+
+// admitTx checks tx against the policy and its approvals and reserves its
+// spend, returning the function to call with the outcome of signing it.
+func (s *Signer) admitTx(ctx context.Context, account accounts.Account, tx *types.Transaction, chainID *big.Int) (func(signed bool), error) {
+	if err := s.checkPolicy(ctx, account, tx, chainID); err != nil {
+		return nil, err
+	}
+	approved, err := s.checkApproval(ctx, account, tx, chainID)
 	if err != nil {
 		return nil, err
 	}
-	if res[64] == 27 || res[64] == 28 {
-		res[64] -= 27 // Transform V from Ethereum-legacy to 0/1
+	reserved, err := s.reserveSpend(ctx, account, tx)
+	if err != nil {
+		approved(false)
+		return nil, err
+	}
+	return func(signed bool) {
+		reserved(signed)
+		approved(signed)
+	}, nil
+}
+
+// finishTx attaches sig to tx and records the outcome in the audit log.
+func (s *Signer) finishTx(ctx context.Context, account accounts.Account, signer types.Signer, tx *types.Transaction, chainID *big.Int, digest, sig []byte, err error) (*types.Transaction, error) {
+	var signed *types.Transaction
+	if err == nil {
+		signed, err = withSignature(signer, tx, sig)
+	}
+	summarized := signed
+	if summarized == nil {
+		summarized = tx
+	}
+	if aerr := s.audit(ctx, audit.OpSignTx, account, digest, sig, summarized, chainID, err); err != nil || aerr != nil {
+		return nil, firstErr(err, aerr)
+	}
+	return signed, nil
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignTxs signs every transaction of txs with account, in parallel if the
+// underlying signer supports it. The results are in the order of txs: for
+// every index either the signed transaction or the error is set, and a failing
+// transaction does not abort the others.
+//
+// Unlike the other methods, the whole batch is bounded by ctx instead of the
+// timeout of the signer.
+func (s *Signer) SignTxs(ctx context.Context, account accounts.Account, txs []*types.Transaction, chainID *big.Int) ([]*types.Transaction, []error) {
+	ctx, span := s.startSpan(s.auditContext(ctx), "SignTxs", account, chainIDAttr(chainID), attribute.Int("eth.tx_count", len(txs)))
+	defer span.End()
+
+	signer := types.LatestSignerForChainID(chainID)
+	signed := make([]*types.Transaction, len(txs))
+	errs := make([]error, len(txs))
+	reqs := make([]digestsigner.SignRequest, 0, len(txs))
+	indices := make([]int, 0, len(txs)) // index in txs of every request
+	dones := make([]func(bool), 0, len(txs))
+	for i, tx := range txs {
+		h := signer.Hash(tx)
+		done, err := s.admitTx(ctx, account, tx, chainID)
+		if err != nil {
+			_, errs[i] = s.finishTx(ctx, account, signer, tx, chainID, h[:], nil, err)
+			continue
+		}
+		reqs = append(reqs, digestsigner.SignRequest{Address: account.Address, Digest: h[:]})
+		indices = append(indices, i)
+		dones = append(dones, done)
+	}
+
+	var results []digestsigner.SignResult
+	if bs, ok := s.kmsSigner.(digestsigner.BatchSigner); ok {
+		results = bs.SignDigests(ctx, reqs)
+	} else {
+		results = digestsigner.SignDigests(ctx, s.kmsSigner, reqs, 0)
+	}
+
+	for j, res := range results {
+		i := indices[j]
+		signed[i], errs[i] = s.finishTx(ctx, account, signer, txs[i], chainID, reqs[j].Digest, res.Signature, res.Err)
+		dones[j](errs[i] == nil)
+	}
+	return signed, errs
+}
+
+func withSignature(signer types.Signer, tx *types.Transaction, sig []byte) (*types.Transaction, error) {
+	if sig[64] == 27 || sig[64] == 28 {
+		sig[64] -= 27 // Transform V from Ethereum-legacy to 0/1
 	}
-	return tx.WithSignature(signer, res)
+	return tx.WithSignature(signer, sig)
 }
 
 // SignTxWithPassphrase is identical to SignTx, but also takes a password
@@ -0,0 +1,176 @@
+package walletsigner
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/audit"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestSigner(t *testing.T) Signer {
+	t.Helper()
+	ms, err := digestsigner.NewMemorySigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSigner(ms, time.Second)
+}
+
+func TestSignTx(t *testing.T) {
+	signer := newTestSigner(t)
+	account := signer.Accounts()[0]
+	chainID := big.NewInt(1)
+
+	tx := types.NewTransaction(0, common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03"), big.NewInt(100), 21000, big.NewInt(1), nil)
+	signedTx, err := signer.SignTx(account, tx, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), signedTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender != account.Address {
+		t.Fatalf("sender mismatch: have %s, want %s", sender, account.Address)
+	}
+}
+
+func TestSignText(t *testing.T) {
+	signer := newTestSigner(t)
+	account := signer.Accounts()[0]
+
+	text := []byte("hello")
+	sig, err := signer.SignText(account, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig[64] > 1 {
+		t.Fatalf("expected canonical V, got %d", sig[64])
+	}
+	pub, err := crypto.Ecrecover(accounts.TextHash(text), sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(crypto.Keccak256(pub[1:])[12:], account.Address.Bytes()) {
+		t.Fatal("recovered address mismatch")
+	}
+}
+
+func TestUnknownAccount(t *testing.T) {
+	signer := newTestSigner(t)
+	account := accounts.Account{Address: common.HexToAddress("0x01")}
+	if signer.Contains(account) {
+		t.Fatal("signer should not contain unknown account")
+	}
+	if _, err := signer.SignData(account, accounts.MimetypeTextPlain, []byte("data")); err == nil {
+		t.Fatal("expected error signing with unknown account")
+	}
+}
+
+func TestSignTxs(t *testing.T) {
+	signer := newTestSigner(t)
+	account := signer.Accounts()[0]
+	chainID := big.NewInt(1)
+
+	var txs []*types.Transaction
+	for nonce := uint64(0); nonce < 5; nonce++ {
+		txs = append(txs, types.NewTransaction(nonce, common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03"), big.NewInt(100), 21000, big.NewInt(1), nil))
+	}
+	signed, errs := signer.SignTxs(context.Background(), account, txs, chainID)
+	for i := range txs {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if signed[i].Nonce() != txs[i].Nonce() {
+			t.Fatalf("result %d is out of order", i)
+		}
+		sender, err := types.Sender(types.LatestSignerForChainID(chainID), signed[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sender != account.Address {
+			t.Fatalf("sender mismatch: have %s, want %s", sender, account.Address)
+		}
+	}
+}
+
+func TestSignTxTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	signer := newTestSigner(t)
+	signer.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	account := signer.Accounts()[0]
+
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(5), GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2), Gas: 21000})
+	if _, err := signer.SignTx(account, tx, big.NewInt(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	sign, ok := spans["walletsigner.SignTx"]
+	if !ok {
+		t.Fatal("missing SignTx span")
+	}
+	attrs := map[attribute.Key]string{}
+	for _, kv := range sign.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	if attrs[AttrChainID] != "5" || attrs[AttrTxType] != "2" || attrs[digestsigner.AttrOutcome] != "OK" {
+		t.Errorf("unexpected SignTx attributes %v", attrs)
+	}
+	if hash, ok := spans["walletsigner.Hash"]; !ok || hash.Parent().SpanID() != sign.SpanContext().SpanID() {
+		t.Fatal("Hash span is not a child of SignTx")
+	}
+}
+
+type memorySink struct {
+	records []*audit.Record
+}
+
+func (s *memorySink) Write(ctx context.Context, rec *audit.Record) error {
+	s.records = append(s.records, rec)
+	return nil
+}
+
+func TestSignTxAudit(t *testing.T) {
+	signer := newTestSigner(t)
+	sink := &memorySink{}
+	signer.SetAuditSink(sink)
+	account := signer.Accounts()[0]
+	chainID := big.NewInt(5)
+
+	tx := types.NewTransaction(3, common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03"), big.NewInt(100), 21000, big.NewInt(1), nil)
+	signedTx, err := signer.WithAuditMetadata(map[string]string{"request": "r1"}).SignTx(account, tx, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.SignText(account, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.records) != 2 {
+		t.Fatalf("have %d records, want 2", len(sink.records))
+	}
+	rec := sink.records[0]
+	if rec.Operation != audit.OpSignTx || rec.Address != account.Address || rec.KeyVersion != account.URL.Path || rec.Metadata["request"] != "r1" {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	if rec.Tx == nil || rec.Tx.Hash != signedTx.Hash() || rec.Tx.Nonce != 3 || rec.Tx.ChainID.ToInt().Int64() != 5 {
+		t.Errorf("unexpected tx summary %+v", rec.Tx)
+	}
+	if rec := sink.records[1]; rec.Operation != audit.OpSignText || rec.Metadata != nil || rec.Tx != nil {
+		t.Errorf("unexpected record %+v", rec)
+	}
+}
@@ -0,0 +1,284 @@
+package walletsigner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Names of the spend limit rules, as reported by PolicyViolation.
+const (
+	RuleWindowMaxValue  = "window_max_value"
+	RuleWindowMaxTxs    = "window_max_txs"
+	RuleWindowMaxTokens = "window_max_tokens"
+)
+
+// DefaultSpendWindow is the window of a SpendLimit without one.
+const DefaultSpendWindow = 24 * time.Hour
+
+// ERC-20 methods moving tokens or allowing a spender to move them, whose
+// amounts count against SpendLimit.MaxTokens.
+var (
+	transferSelector          = Selector{0xa9, 0x05, 0x9c, 0xbb} // transfer(address,uint256)
+	transferFromSelector      = Selector{0x23, 0xb8, 0x72, 0xdd} // transferFrom(address,address,uint256)
+	approveSelector           = Selector{0x09, 0x5e, 0xa7, 0xb3} // approve(address,uint256)
+	increaseAllowanceSelector = Selector{0x39, 0x50, 0x93, 0x51} // increaseAllowance(address,uint256)
+)
+
+// SpendLimit bounds what an address may spend within a rolling window. Unset
+// limits are not checked.
+type SpendLimit struct {
+	Window    Duration                `json:"window,omitempty"` // defaults to DefaultSpendWindow
+	MaxValue  *Wei                    `json:"max_value,omitempty"`
+	MaxTxs    int                     `json:"max_txs,omitempty"`
+	MaxTokens map[common.Address]*Wei `json:"max_tokens,omitempty"` // per ERC-20 contract, in the smallest unit of the token
+}
+
+func (l *SpendLimit) window() time.Duration {
+	if l.Window <= 0 {
+		return DefaultSpendWindow
+	}
+	return time.Duration(l.Window)
+}
+
+// SpendLimits configures the SpendLimit of every address, falling back to
+// Default for addresses without a limit of their own.
+type SpendLimits struct {
+	Default   *SpendLimit                    `json:"default,omitempty"`
+	Addresses map[common.Address]*SpendLimit `json:"addresses,omitempty"`
+}
+
+// LoadSpendLimits reads SpendLimits from a YAML or JSON file, with windows
+// written as durations, e.g. "24h".
+func LoadSpendLimits(path string) (*SpendLimits, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpendLimits(data)
+}
+
+// ParseSpendLimits parses SpendLimits from YAML or JSON.
+func ParseSpendLimits(data []byte) (*SpendLimits, error) {
+	l := &SpendLimits{}
+	if err := decodeConfig(data, l); err != nil {
+		return nil, fmt.Errorf("invalid spend limits: %w", err)
+	}
+	return l, nil
+}
+
+// Limit returns the limit applying to address.
+func (l *SpendLimits) Limit(address common.Address) *SpendLimit {
+	if limit, ok := l.Addresses[address]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// Spend is a signed or pending transaction counted against a SpendLimit.
+type Spend struct {
+	ID          string          `json:"id"`
+	Time        time.Time       `json:"time"`
+	Value       *big.Int        `json:"value"`
+	Token       *common.Address `json:"token,omitempty"`
+	TokenAmount *big.Int        `json:"token_amount,omitempty"`
+	Pending     bool            `json:"pending,omitempty"` // reserved, but not signed yet
+}
+
+// SpendStore keeps the spends of every address.
+type SpendStore interface {
+	// Update atomically replaces the spends of address with the result of
+	// fn. Nothing is changed if fn fails.
+	Update(address common.Address, fn func(spends []Spend) ([]Spend, error)) error
+}
+
+// SpendLimiter enforces SpendLimits: SignTx reserves the spend of a
+// transaction before signing it, and commits the reservation once signed or
+// releases it on failure.
+type SpendLimiter struct {
+	limits *SpendLimits
+	store  SpendStore
+	now    func() time.Time
+}
+
+// NewSpendLimiter creates a limiter keeping its state in store, e.g. a
+// MemorySpendStore or a FileSpendStore.
+func NewSpendLimiter(limits *SpendLimits, store SpendStore) *SpendLimiter {
+	return &SpendLimiter{limits: limits, store: store, now: time.Now}
+}
+
+// SetSpendLimiter sets the limiter checked by SignTx and SignTxs after the
+// policy.
+func (s *Signer) SetSpendLimiter(l *SpendLimiter) {
+	s.spendLimiter = l
+}
+
+// reserveSpend reserves the spend of tx, returning the function to call with
+// the outcome of signing it.
+func (s *Signer) reserveSpend(ctx context.Context, account accounts.Account, tx *types.Transaction) (func(signed bool), error) {
+	if s.spendLimiter == nil {
+		return func(bool) {}, nil
+	}
+	_, span := s.startSpan(ctx, "ReserveSpend", account)
+	id, err := s.spendLimiter.Reserve(account.Address, tx)
+	endSpan(span, err)
+	if err != nil || id == "" {
+		return func(bool) {}, err
+	}
+	return func(signed bool) {
+		if err := s.spendLimiter.finish(account.Address, id, signed); err != nil {
+			log.Error("failed to record spend", "address", account.Address, "id", id, "signed", signed, "err", err)
+		}
+	}, nil
+}
+
+// Reserve checks that tx keeps address within its limit and reserves its
+// spend, returning the id of the reservation. The id is empty if no limit
+// applies to address.
+func (l *SpendLimiter) Reserve(address common.Address, tx *types.Transaction) (string, error) {
+	limit := l.limits.Limit(address)
+	if limit == nil {
+		return "", nil
+	}
+	now := l.now()
+	spend := Spend{ID: newSpendID(), Time: now, Value: tx.Value(), Pending: true}
+	spend.Token, spend.TokenAmount = decodeTokenTransfer(tx)
+
+	err := l.store.Update(address, func(spends []Spend) ([]Spend, error) {
+		kept := spends[:0:0]
+		for _, s := range spends {
+			if now.Sub(s.Time) < limit.window() {
+				kept = append(kept, s)
+			}
+		}
+		if err := limit.check(address, append(kept, spend)); err != nil {
+			return nil, err
+		}
+		return append(kept, spend), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return spend.ID, nil
+}
+
+// Commit records the reserved spend as signed.
+func (l *SpendLimiter) Commit(address common.Address, id string) error {
+	return l.finish(address, id, true)
+}
+
+// Release drops the reserved spend of a transaction that was not signed.
+func (l *SpendLimiter) Release(address common.Address, id string) error {
+	return l.finish(address, id, false)
+}
+
+func (l *SpendLimiter) finish(address common.Address, id string, signed bool) error {
+	return l.store.Update(address, func(spends []Spend) ([]Spend, error) {
+		result := spends[:0:0]
+		for _, s := range spends {
+			if s.ID == id {
+				if !signed {
+					continue
+				}
+				s.Pending = false
+			}
+			result = append(result, s)
+		}
+		return result, nil
+	})
+}
+
+// check returns a violation if spends exceed the limit.
+func (l *SpendLimit) check(address common.Address, spends []Spend) error {
+	violation := func(rule, format string, args ...interface{}) error {
+		return &PolicyViolation{Rule: rule, Address: address, Reason: fmt.Sprintf(format, args...)}
+	}
+	if l.MaxTxs > 0 && len(spends) > l.MaxTxs {
+		return violation(RuleWindowMaxTxs, "more than %d transactions within %v", l.MaxTxs, l.window())
+	}
+	value := new(big.Int)
+	tokens := map[common.Address]*big.Int{}
+	for _, s := range spends {
+		value.Add(value, s.Value)
+		if s.Token != nil {
+			if tokens[*s.Token] == nil {
+				tokens[*s.Token] = new(big.Int)
+			}
+			tokens[*s.Token].Add(tokens[*s.Token], s.TokenAmount)
+		}
+	}
+	if l.MaxValue != nil && value.Cmp(l.MaxValue.ToInt()) > 0 {
+		return violation(RuleWindowMaxValue, "%v wei within %v exceeds %v", value, l.window(), l.MaxValue)
+	}
+	for token, max := range l.MaxTokens {
+		if amount := tokens[token]; amount != nil && amount.Cmp(max.ToInt()) > 0 {
+			return violation(RuleWindowMaxTokens, "%v of token %s within %v exceeds %v", amount, token, l.window(), max)
+		}
+	}
+	return nil
+}
+
+// decodeTokenTransfer returns the token contract and amount of an ERC-20
+// transfer, transferFrom, approve or increaseAllowance call. An allowance
+// counts as spent once granted, since the spender may use it at any time.
+// Call data beyond the arguments is ignored, as it is by the token.
+func decodeTokenTransfer(tx *types.Transaction) (*common.Address, *big.Int) {
+	data := tx.Data()
+	if tx.To() == nil || len(data) < 4 {
+		return nil, nil
+	}
+	var sel Selector
+	copy(sel[:], data)
+	var args int
+	switch sel {
+	case transferSelector, approveSelector, increaseAllowanceSelector:
+		args = 2
+	case transferFromSelector:
+		args = 3
+	default:
+		return nil, nil
+	}
+	if len(data) < 4+32*args {
+		return nil, nil
+	}
+	to := *tx.To()
+	return &to, new(big.Int).SetBytes(data[4+32*(args-1) : 4+32*args])
+}
+
+func newSpendID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// Duration is a time.Duration decoded from a string such as "24h".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
@@ -0,0 +1,143 @@
+package walletsigner
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func transferData(to common.Address, amount int64) []byte {
+	return tokenCallData(transferSelector, to, amount)
+}
+
+// tokenCallData encodes a call of an ERC-20 method taking addresses and an
+// amount.
+func tokenCallData(sel Selector, args ...interface{}) []byte {
+	data := append([]byte{}, sel[:]...)
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case common.Address:
+			data = append(data, common.LeftPadBytes(arg[:], 32)...)
+		case int64:
+			data = append(data, common.LeftPadBytes(big.NewInt(arg).Bytes(), 32)...)
+		}
+	}
+	return data
+}
+
+func TestSpendLimiter(t *testing.T) {
+	token := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	limits, err := ParseSpendLimits([]byte(`
+default:
+  window: 1h
+  max_value: 2 ether
+  max_txs: 4
+  max_tokens:
+    "` + token.Hex() + `": "1000"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFileSpendStore(filepath.Join(t.TempDir(), "spends.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewSpendLimiter(limits, store)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	signer := newTestSigner(t)
+	signer.SetSpendLimiter(limiter)
+	account := signer.Accounts()[0]
+	chainID := big.NewInt(1)
+	to := common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03")
+	ether := big.NewInt(params.Ether)
+	sign := func(nonce uint64, to common.Address, value *big.Int, data []byte) error {
+		_, err := signer.SignTx(account, types.NewTransaction(nonce, to, value, 60000, big.NewInt(1), data), chainID)
+		return err
+	}
+	expect := func(err error, rule string) {
+		t.Helper()
+		var violation *PolicyViolation
+		if rule == "" && err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if rule != "" && (!errors.As(err, &violation) || violation.Rule != rule) {
+			t.Fatalf("expected violation of %s, got %v", rule, err)
+		}
+	}
+
+	expect(sign(0, to, ether, nil), "")
+	expect(sign(1, to, new(big.Int).Add(ether, big.NewInt(1)), nil), RuleWindowMaxValue)
+	expect(sign(1, token, common.Big0, transferData(to, 600)), "")
+	expect(sign(2, token, common.Big0, transferData(to, 401)), RuleWindowMaxTokens)
+	expect(sign(2, token, common.Big0, transferData(to, 400)), "")
+	expect(sign(3, token, common.Big0, tokenCallData(approveSelector, to, int64(1))), RuleWindowMaxTokens)
+
+	// the state survives a restart
+	store, err = NewFileSpendStore(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.store = store
+	expect(sign(3, to, ether, nil), "")
+	expect(sign(4, to, common.Big1, nil), RuleWindowMaxTxs)
+
+	// spends leave the window
+	now = now.Add(time.Hour)
+	expect(sign(4, to, ether, nil), "")
+
+	// failed signatures are released
+	other := account
+	other.Address = common.Address{1}
+	if _, err := signer.SignTx(other, types.NewTransaction(5, to, ether, 21000, big.NewInt(1), nil), chainID); err == nil {
+		t.Fatal("expected unknown account to fail")
+	}
+	store.Update(other.Address, func(spends []Spend) ([]Spend, error) {
+		if len(spends) != 0 {
+			t.Errorf("expected the reservation to be released, have %v", spends)
+		}
+		return spends, nil
+	})
+}
+
+func TestDecodeTokenTransfer(t *testing.T) {
+	token := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	to := common.HexToAddress("0x4549f47920997A486e9986d2e3e4540230534A03")
+	for _, tt := range []struct {
+		method string
+		data   []byte
+		amount int64 // 0 if not a token spend
+	}{
+		{"transfer(address,uint256)", tokenCallData(transferSelector, to, int64(7)), 7},
+		{"transferFrom(address,address,uint256)", tokenCallData(transferFromSelector, to, to, int64(7)), 7},
+		{"approve(address,uint256)", tokenCallData(approveSelector, to, int64(7)), 7},
+		{"increaseAllowance(address,uint256)", tokenCallData(increaseAllowanceSelector, to, int64(7)), 7},
+		{"approve(address,uint256)", append(tokenCallData(approveSelector, to, int64(7)), 0), 7},
+		{"approve(address,uint256)", tokenCallData(approveSelector, to), 0},
+		{"decreaseAllowance(address,uint256)", tokenCallData(Selector{0xa4, 0x57, 0xc2, 0xd7}, to, int64(7)), 0},
+	} {
+		var sel Selector
+		if err := sel.UnmarshalText([]byte(tt.method)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sel[:], tt.data[:4]) {
+			t.Fatalf("%s: selector mismatch", tt.method)
+		}
+		tx := types.NewTransaction(0, token, common.Big0, 60000, big.NewInt(1), tt.data)
+		addr, amount := decodeTokenTransfer(tx)
+		switch {
+		case tt.amount == 0 && addr != nil:
+			t.Errorf("%s: unexpected token spend of %v", tt.method, amount)
+		case tt.amount != 0 && (addr == nil || *addr != token || amount.Int64() != tt.amount):
+			t.Errorf("%s: have %v of %v, want %d", tt.method, amount, addr, tt.amount)
+		}
+	}
+}
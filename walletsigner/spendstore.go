@@ -0,0 +1,105 @@
+package walletsigner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MemorySpendStore keeps spends in memory, so they are lost on restart.
+type MemorySpendStore struct {
+	mu     sync.Mutex
+	spends map[common.Address][]Spend
+}
+
+var _ SpendStore = (*MemorySpendStore)(nil)
+
+func NewMemorySpendStore() *MemorySpendStore {
+	return &MemorySpendStore{spends: map[common.Address][]Spend{}}
+}
+
+func (m *MemorySpendStore) Update(address common.Address, fn func([]Spend) ([]Spend, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	spends, err := fn(m.spends[address])
+	if err != nil {
+		return err
+	}
+	m.spends[address] = spends
+	return nil
+}
+
+// FileSpendStore keeps spends in a JSON file, which is atomically replaced on
+// every update. Reservations still pending when the process stopped keep
+// counting against the limit until they leave the window.
+type FileSpendStore struct {
+	path string
+
+	mu     sync.Mutex
+	spends map[common.Address][]Spend
+}
+
+var _ SpendStore = (*FileSpendStore)(nil)
+
+// NewFileSpendStore loads the spends stored at path, if it exists.
+func NewFileSpendStore(path string) (*FileSpendStore, error) {
+	f := &FileSpendStore{path: path, spends: map[common.Address][]Spend{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &f.spends); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileSpendStore) Update(address common.Address, fn func([]Spend) ([]Spend, error)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	spends, err := fn(f.spends[address])
+	if err != nil {
+		return err
+	}
+	next := make(map[common.Address][]Spend, len(f.spends)+1)
+	for addr, s := range f.spends {
+		next[addr] = s
+	}
+	next[address] = spends
+	if err := writeFileAtomic(f.path, next); err != nil {
+		return err
+	}
+	f.spends = next
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with v encoded as JSON.
+func writeFileAtomic(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,70 @@
+package walletsigner
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/wfblockchain/gcp-kms-signer-dlt/digestsigner"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+)
+
+const instrumentationName = "github.com/wfblockchain/gcp-kms-signer-dlt/walletsigner"
+
+// Span attributes set by the wallet, on top of the ones of digestsigner.
+const (
+	AttrChainID  = attribute.Key("eth.chain_id")
+	AttrTxType   = attribute.Key("eth.tx_type")
+	AttrMimeType = attribute.Key("eth.mime_type")
+)
+
+// SetTracerProvider sets the provider of the OpenTelemetry spans created by
+// the wallet. The global provider is used by default.
+func (s *Signer) SetTracerProvider(tp trace.TracerProvider) {
+	s.tracerProvider = tp
+}
+
+func (s *Signer) startSpan(ctx context.Context, name string, account accounts.Account, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tp := s.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	attrs = append(attrs, digestsigner.AttrAddress.String(account.Address.Hex()))
+	return tp.Tracer(instrumentationName).Start(ctx, "walletsigner."+name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records the outcome of a call on span and ends it.
+func endSpan(span trace.Span, err error) {
+	span.SetAttributes(digestsigner.AttrOutcome.String(errorCode(err).String()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// errorCode extends digestsigner.ErrorCode with the errors raised by the
+// wallet itself.
+func errorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, ErrPolicyViolation), errors.Is(err, ErrNotApprover):
+		return codes.PermissionDenied
+	case errors.Is(err, ErrApprovalRequired), errors.Is(err, ErrApprovalExpired), errors.Is(err, ErrApprovalCancelled), errors.Is(err, ErrApprovalConsumed):
+		return codes.FailedPrecondition
+	case errors.Is(err, ErrUnknownApproval):
+		return codes.NotFound
+	}
+	return digestsigner.ErrorCode(err)
+}
+
+func chainIDAttr(chainID *big.Int) attribute.KeyValue {
+	if chainID == nil {
+		return AttrChainID.String("")
+	}
+	return AttrChainID.String(chainID.String())
+}